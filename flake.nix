@@ -21,14 +21,18 @@
       # Parameters:
       #   - system: The system architecture (e.g., "x86_64-linux")
       #   - infraConfig: Path to the Terranix infrastructure configuration
-      #   - machineConfig: Path to the NixOS machine configuration
+      #   - machineConfig: Path to the NixOS machine configuration (default module for every instance)
+      #   - instanceConfigs: (Optional) Attrset of instance name -> NixOS module for multi-instance projects
+      #                      Instances without an entry use machineConfig
+      #   - commonConfigs: (Optional) List of NixOS modules imported by every instance
       #   - projectName: (Optional) Name for the project, used to organize .inframan/<projectName>/ folders
       #                  Defaults to "default" if not specified
+      #   - engine: (Optional) IaC engine, "terraform" or "tofu" (OpenTofu). Defaults to "terraform"
       #   - sshKeyPath: (Optional) Path to SSH private key for deployment and SSH access
       #                 Can be absolute path or relative to the project root
       #   - sshConfigPath: (Optional) Path to SSH config file for deployment and SSH access
       #                    Useful for multi-user setups where each user has different keys
-      lib.mkRunner = { system, infraConfig, machineConfig, projectName ? "default", sshKeyPath ? null, sshConfigPath ? null }:
+      lib.mkRunner = { system, infraConfig, machineConfig, instanceConfigs ? {}, commonConfigs ? [], projectName ? "default", engine ? "terraform", sshKeyPath ? null, sshConfigPath ? null }:
         let
           pkgs = import nixpkgs {
             config.allowUnfree = true;
@@ -41,9 +45,22 @@
             modules = [ infraConfig ];
           };
 
+          # Machine module mapping: a JSON file with store paths when per-instance
+          # or common modules are given, otherwise the single machine module
+          machineModules = if instanceConfigs == {} && commonConfigs == []
+            then machineConfig
+            else pkgs.writeText "machine-modules.json" (builtins.toJSON {
+              default = "${machineConfig}";
+              common = map (m: "${m}") commonConfigs;
+              instances = lib.mapAttrs (_: m: "${m}") instanceConfigs;
+            });
+
           # The inframan Go binary
           inframanBin = self.packages.${system}.default;
 
+          # IaC engine package providing the terraform or tofu binary
+          enginePkg = if engine == "tofu" then pkgs.opentofu else pkgs.terraform;
+
           # SSH key export line (only if sshKeyPath is provided)
           sshKeyExport = if sshKeyPath != null
             then ''export SSH_KEY_PATH="${sshKeyPath}"''
@@ -57,15 +74,16 @@
         pkgs.writeShellApplication {
           name = "runner";
           runtimeInputs = [
-            pkgs.terraform
+            enginePkg
             colmena.packages.${system}.colmena
             pkgs.nix
           ];
           text = ''
             # Export environment variables for the Go tool
             export INFRA_CONFIG_JSON="${terranixConfig}"
-            export NIXOS_MODULE_PATH="${machineConfig}"
+            export NIXOS_MODULE_PATH="${machineModules}"
             export PROJECT_NAME="${projectName}"
+            export INFRAMAN_ENGINE="${engine}"
             ${sshKeyExport}
             ${sshConfigExport}
 
@@ -102,6 +120,7 @@
           packages = [
             pkgs.go
             pkgs.terraform
+            pkgs.opentofu
             colmena.packages.${system}.colmena
             pkgs.nix
           ];
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"github.com/iivel-inc/inframan/internal/commands"
+	"github.com/iivel-inc/inframan/internal/orchestrator"
 	"github.com/spf13/cobra"
 )
 
@@ -12,27 +13,128 @@ var rootCmd = &cobra.Command{
 	Long: `Inframan is a CLI tool that bridges Terranix (Infrastructure as Code)
 and Colmena (NixOS Deployment).
 
+Configuration is read from an inframan.json project file, discovered by
+walking up from the working directory, or from the workspace root if it is
+set with --workspace or INFRAMAN_ROOT. Environment variables override the
+project file, and flags override both.
+
 Environment Variables:
   INFRA_CONFIG_JSON  - Path to the Terranix-generated JSON file
   NIXOS_MODULE_PATH  - Path to the NixOS configuration module
   PROJECT_NAME       - Project name for organizing .inframan/<project>/ folders (default: "default")
+  SSH_KEY_PATH       - SSH private key for deployment and ssh
+  SSH_CONFIG_PATH    - SSH config file for deployment and ssh
+  SSH_USER           - SSH user (default: "root")
+  SSH_BASTION        - Jump host ([user@]host[:port] or project/instance) for private instances
+  INFRAMAN_CONFIG    - Path to the inframan.json project file
+  INFRAMAN_ROOT      - Workspace root holding .inframan/ (default: nearest directory
+                       with .inframan or inframan.json, else flake.nix or .git)
+  INFRAMAN_ENGINE    - IaC engine: "terraform" or "tofu" (default: recorded per project, else detected on PATH)
+  INFRAMAN_ENGINE_PATH - Path to the engine binary
+  INFRAMAN_NON_INTERACTIVE - Never prompt, same as --non-interactive
+
+Non-interactive mode (--non-interactive or --auto-approve) passes
+-auto-approve -input=false to terraform, never reads stdin and exits with
+0 for no changes, 2 for changes applied and 1 for failure.
+
+Progress messages and terraform and colmena output go to stderr, so stdout
+holds only results. With --output json or yaml, ssh --list, plan, drift,
+deploy --check, exec, history and hostkeys print their results as JSON or
+YAML. Other commands reject --output json and yaml.
 
 Commands:
-  infra   - Build and apply infrastructure using Terraform
-  deploy  - Deploy NixOS configuration using Colmena
-  destroy - Destroy infrastructure using Terraform
-  ssh     - SSH to an instance by project name`,
+  infra    - Build and apply infrastructure using Terraform
+  plan     - Plan infrastructure changes and save the plan
+  deploy   - Deploy NixOS configuration using Colmena
+  up       - Provision infrastructure, wait for SSH, then deploy
+  destroy  - Destroy infrastructure using Terraform
+  drift    - Detect infrastructure drift from the terraform state
+  ssh      - SSH to an instance by project name
+  ssh-config - Write an SSH config for every instance
+  exec     - Run a command on every matching instance
+  cp       - Copy files to or from an instance
+  tunnel   - Forward local ports to an instance
+  rollback - Activate an earlier NixOS generation on an instance
+  history  - Show what was deployed to the project and when
+  hostkeys - List or reset pinned SSH host keys
+  unlock   - Remove a project lock left by an interrupted run`,
 }
 
+// Global flag values
+var (
+	// nonInteractive is bound to the --non-interactive and --auto-approve flags
+	nonInteractive bool
+
+	// projectName is bound to the --project flag
+	projectName string
+
+	// configPath is bound to the --config flag
+	configPath string
+
+	// workspace is bound to the --workspace flag
+	workspace string
+
+	// output is bound to the --output flag
+	output string
+)
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() error {
 	return rootCmd.Execute()
 }
 
+// ExitCode returns the process exit code for the result of Execute
+func ExitCode(err error) int {
+	return commands.ExitCode(err)
+}
+
 func init() {
+	// Global flags
+	rootCmd.PersistentFlags().BoolVar(&nonInteractive, "non-interactive", false, "Never prompt; auto-approve terraform and use CI exit codes")
+	rootCmd.PersistentFlags().BoolVar(&nonInteractive, "auto-approve", false, "Alias for --non-interactive")
+	rootCmd.PersistentFlags().StringVarP(&projectName, "project", "p", "", "Project name (overrides PROJECT_NAME and inframan.json)")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to the inframan.json project file (default: discovered upward from the workspace root or working directory)")
+	rootCmd.PersistentFlags().StringVar(&workspace, "workspace", "", "Workspace root holding .inframan/ (default: discovered upward from the working directory)")
+	rootCmd.PersistentFlags().StringVar(&output, "output", "table", "Result format of commands that print results: table, json or yaml")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := commands.SetOutputFormat(cmd, output); err != nil {
+			return err
+		}
+		if nonInteractive {
+			orchestrator.SetNonInteractive(true)
+		}
+		if projectName != "" {
+			orchestrator.SetProjectName(projectName)
+		}
+		if configPath != "" {
+			orchestrator.SetProjectFilePath(configPath)
+		}
+		if workspace != "" {
+			orchestrator.SetWorkspaceRoot(workspace)
+		}
+
+		// Load the project file once and report a broken one before any
+		// command reads it
+		if err := orchestrator.InitProjectFile(); err != nil {
+			return err
+		}
+		return nil
+	}
+
 	// Add subcommands
 	rootCmd.AddCommand(commands.NewInfraCommand())
+	rootCmd.AddCommand(commands.NewPlanCommand())
 	rootCmd.AddCommand(commands.NewDeployCommand())
+	rootCmd.AddCommand(commands.NewUpCommand())
 	rootCmd.AddCommand(commands.NewDestroyCommand())
+	rootCmd.AddCommand(commands.NewDriftCommand())
 	rootCmd.AddCommand(commands.NewSSHCommand())
+	rootCmd.AddCommand(commands.NewSSHConfigCommand())
+	rootCmd.AddCommand(commands.NewExecCommand())
+	rootCmd.AddCommand(commands.NewCpCommand())
+	rootCmd.AddCommand(commands.NewTunnelCommand())
+	rootCmd.AddCommand(commands.NewRollbackCommand())
+	rootCmd.AddCommand(commands.NewHistoryCommand())
+	rootCmd.AddCommand(commands.NewHostKeysCommand())
+	rootCmd.AddCommand(commands.NewUnlockCommand())
 }
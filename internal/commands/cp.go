@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// NewCpCommand creates the cp command
+func NewCpCommand() *cobra.Command {
+	var opts orchestrator.CopyOptions
+
+	cmd := &cobra.Command{
+		Use:   "cp <source> <destination>",
+		Short: "Copy files to or from an instance",
+		Long: `Cp copies files between this machine and an instance with scp, using the
+same identity, user, bastion and host key checking as inframan ssh.
+
+One of source and destination is a remote path written selector:path, where
+the selector must match exactly one instance. A remote path without a
+directory is relative to the user's home directory. Local paths containing
+a colon must start with /, . or ~.
+
+With --rsync, files are copied with rsync -az, transferring only what
+changed; directories are always copied recursively.
+
+Examples:
+  # Upload a file
+  inframan cp ./app.env production/web-1:/etc/app.env
+
+  # Download a directory
+  inframan cp -r production/db-1:/var/backups ./backups
+
+  # Sync a directory with rsync
+  inframan cp --rsync ./site/ production/web-1:/var/www/site`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return copyFiles(args[0], args[1], opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Recursive, "recursive", "r", false, "Copy directories recursively")
+	cmd.Flags().BoolVar(&opts.Rsync, "rsync", false, "Copy with rsync instead of scp")
+	cmd.Flags().StringVarP(&opts.SSH.User, "user", "u", "", "SSH user (default: the instance's ssh_user, SSH_USER or inframan.json, else root)")
+	cmd.Flags().StringVarP(&opts.SSH.IdentityFile, "identity", "i", "", "Path to SSH identity file")
+
+	return cmd
+}
+
+// parseCopyPath splits a cp argument into an instance selector and a path.
+// Paths starting with /, . or ~ are always local, so they may contain colons.
+func parseCopyPath(arg string) (selector, path string, remote bool) {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") || strings.HasPrefix(arg, "~") {
+		return "", arg, false
+	}
+	i := strings.Index(arg, ":")
+	if i < 0 {
+		return "", arg, false
+	}
+	return arg[:i], arg[i+1:], true
+}
+
+// copyFiles copies source to destination, exactly one of which is remote
+func copyFiles(source, destination string, opts orchestrator.CopyOptions) error {
+	srcSelector, srcPath, srcRemote := parseCopyPath(source)
+	dstSelector, dstPath, dstRemote := parseCopyPath(destination)
+
+	switch {
+	case srcRemote && dstRemote:
+		return fmt.Errorf("copying between instances is not supported; copy through a local directory")
+	case !srcRemote && !dstRemote:
+		return fmt.Errorf("one of source and destination must be a remote path, e.g. production/web-1:/tmp")
+	}
+
+	selector, local, remote := srcSelector, dstPath, srcPath
+	if dstRemote {
+		selector, local, remote = dstSelector, srcPath, dstPath
+	}
+
+	info, err := selectInstance(selector)
+	if err != nil {
+		return fmt.Errorf("failed to get instance info: %w", err)
+	}
+
+	if dstRemote {
+		fmt.Printf("Copying %s to %s:%s...\n", local, info.FullName(), remote)
+	} else {
+		fmt.Printf("Copying %s:%s to %s...\n", info.FullName(), remote, local)
+	}
+	return orchestrator.Copy(info, opts, local, remote, dstRemote)
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+)
+
+func TestParseCopyPath(t *testing.T) {
+	tests := []struct {
+		arg      string
+		selector string
+		path     string
+		remote   bool
+	}{
+		{arg: "production/web-1:/etc/app.env", selector: "production/web-1", path: "/etc/app.env", remote: true},
+		{arg: "account1:", selector: "account1", path: "", remote: true},
+		{arg: "@db:backups", selector: "@db", path: "backups", remote: true},
+		{arg: "app.env", path: "app.env"},
+		{arg: "./a:b", path: "./a:b"},
+		{arg: "/tmp/a:b", path: "/tmp/a:b"},
+	}
+
+	for _, tt := range tests {
+		selector, path, remote := parseCopyPath(tt.arg)
+		if selector != tt.selector || path != tt.path || remote != tt.remote {
+			t.Errorf("parseCopyPath(%q) = %q, %q, %v, want %q, %q, %v", tt.arg, selector, path, remote, tt.selector, tt.path, tt.remote)
+		}
+	}
+}
+
+func TestCopyFiles(t *testing.T) {
+	fake := setupProject(t, "prod", `{"instances": {"value": {"web-1": "10.0.0.1", "db-1": "10.0.0.2"}}}`)
+
+	if err := copyFiles("prod/db-1:/var/backups", "./backups", orchestrator.CopyOptions{Recursive: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	calls := fake.Calls()
+	if got := calls[len(calls)-1].String(); !strings.HasPrefix(got, "scp ") || !strings.HasSuffix(got, " -r root@10.0.0.2:/var/backups ./backups") {
+		t.Errorf("command = %q", got)
+	}
+
+	for _, args := range [][2]string{{"a", "b"}, {"prod/web-1:a", "prod/db-1:b"}} {
+		if err := copyFiles(args[0], args[1], orchestrator.CopyOptions{}); err == nil {
+			t.Errorf("copyFiles(%q, %q) succeeded", args[0], args[1])
+		}
+	}
+	if err := copyFiles("app.env", "prod:/tmp", orchestrator.CopyOptions{}); err == nil || !strings.Contains(err.Error(), "matches 2 instances") {
+		t.Errorf("copyFiles() to a project with 2 instances error = %v", err)
+	}
+}
@@ -2,7 +2,10 @@ package commands
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/iivel-inc/inframan/internal/orchestrator"
 	"github.com/spf13/cobra"
@@ -10,24 +13,85 @@ import (
 
 // NewDeployCommand creates the deploy command
 func NewDeployCommand() *cobra.Command {
+	var wait time.Duration
+	var check bool
+	var rollout rolloutOptions
+
 	cmd := &cobra.Command{
-		Use:   "deploy",
+		Use:   "deploy [selector]",
 		Short: "Deploy NixOS configuration using Colmena",
 		Long: `Deploy orchestrates NixOS deployment:
 1. Fetches infrastructure state from Terraform
-2. Parses target IP from terraform output
-3. Generates ephemeral hive.nix with injected IP
-4. Runs colmena apply to deploy to the target`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// Get NIXOS_MODULE_PATH from environment
-			nixosModulePath := os.Getenv("NIXOS_MODULE_PATH")
-			if nixosModulePath == "" {
-				return fmt.Errorf("NIXOS_MODULE_PATH environment variable is not set")
+2. Parses instances from terraform output ('instances' map or 'public_ip')
+3. Generates ephemeral hive.nix with one node per instance, importing the
+   instance's machine modules and with its IP injected
+4. Runs colmena apply to deploy to all nodes in a single run
+
+NIXOS_MODULE_PATH (or machine_modules in inframan.json) can be a single
+module applied to every instance, a directory of <instance>.nix files (plus
+optional common.nix imported by all nodes and default.nix for instances
+without their own file), or a JSON file mapping
+{"default": ..., "common": [...], "instances": {"web-1": ...}}.
+
+A selector limits the deploy to some instances of the current project, e.g.
+prod/web-* or prod/@canary.
+
+With --check, nothing is deployed. Instead each node's expected system
+toplevel is evaluated and compared to /run/current-system on the host over
+SSH, reporting every instance as in sync, drifted or unreachable. The exit
+code is 2 if any host drifted and 1 if any host was unreachable.
+
+After activation, the project's health_checks from inframan.json and the
+checks given with --health-http, --health-tcp and --health-command run
+against every instance, and the deploy fails if any check fails.
+
+With --batch-size N, instances are deployed N at a time and the health
+checks must pass on every instance of a batch within --health-timeout,
+otherwise the remaining instances are not deployed. With
+--rollback-on-failure, a batch whose health checks or colmena apply fail is
+also switched back to the generation it ran before.
+
+Examples:
+  # Deploy two instances at a time, gating on an HTTP endpoint
+  inframan deploy --batch-size 2 --health-http http://{ip}/healthz
+
+  # Roll back a batch whose nginx does not come up
+  inframan deploy --batch-size 1 --health-command 'systemctl is-active nginx' --rollback-on-failure`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			out := newOutput()
+			if !check {
+				if err := out.tableOnly("deploy without --check"); err != nil {
+					return err
+				}
+			}
+
+			release, err := lockProject("deploy", wait)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			// --check only inspects hosts, so it is not recorded
+			entry := &orchestrator.HistoryEntry{Command: "deploy", ModulePath: orchestrator.GetNixOSModulePath()}
+			if !check {
+				defer func() { recordHistory(orchestrator.GetProjectName(), entry, err) }()
+			}
+
+			if err := rollout.validate(); err != nil {
+				return err
+			}
+
+			var selector *orchestrator.Selector
+			if len(args) == 1 {
+				if selector, err = parseProjectSelector(args[0]); err != nil {
+					return err
+				}
 			}
 
-			// Verify the module file exists
-			if _, err := os.Stat(nixosModulePath); os.IsNotExist(err) {
-				return fmt.Errorf("NIXOS_MODULE_PATH file does not exist: %s", nixosModulePath)
+			modules, err := loadMachineModules()
+			if err != nil {
+				return err
 			}
 
 			// Create terraform executor to get output
@@ -35,39 +99,364 @@ func NewDeployCommand() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("failed to create terraform executor: %w", err)
 			}
+			terraformExec.SetOutput(out.progress)
 
-			// Get target IP from terraform output
-			fmt.Println("Fetching infrastructure state...")
-			targetIP, err := terraformExec.GetTargetIP()
+			// Get target instances from terraform output
+			fmt.Fprintln(out.progress, "Fetching infrastructure state...")
+			instances, err := terraformExec.GetInstances()
 			if err != nil {
-				return fmt.Errorf("failed to get target IP: %w", err)
+				return fmt.Errorf("failed to get target instances: %w", err)
 			}
-			fmt.Printf("Target IP: %s\n", targetIP)
+			if selector != nil {
+				if instances, err = selector.Filter(instances); err != nil {
+					return err
+				}
+			}
+			entry.Instances = instanceNames(instances)
 
-			// Create colmena executor
-			colmenaExec, err := orchestrator.NewColmenaExecutor()
-			if err != nil {
-				return fmt.Errorf("failed to create colmena executor: %w", err)
+			if check {
+				return checkInstances(out, modules, instances)
 			}
 
-			// Generate dynamic hive.nix
-			fmt.Println("Generating Colmena hive configuration...")
-			hivePath, err := colmenaExec.GenerateHive(nixosModulePath, targetIP)
-			if err != nil {
-				return fmt.Errorf("failed to generate hive: %w", err)
+			return deployInstances(out, modules, instances, rollout)
+		},
+	}
+
+	addWaitFlag(cmd, &wait)
+	cmd.Flags().BoolVar(&check, "check", false, "Compare each host's running system to the expected configuration instead of deploying")
+	cmd.Flags().IntVar(&rollout.batchSize, "batch-size", 0, "Deploy this many instances at a time (default: all at once)")
+	cmd.Flags().StringVar(&rollout.healthHTTP, "health-http", "", "URL that must answer 2xx/3xx after deploying ({ip} is replaced by the instance's IP)")
+	cmd.Flags().IntVar(&rollout.healthTCP, "health-tcp", 0, "TCP port that must accept connections after deploying")
+	cmd.Flags().StringVar(&rollout.healthCommand, "health-command", "", "Command that must succeed on each instance over SSH after deploying")
+	cmd.Flags().DurationVar(&rollout.healthTimeout, "health-timeout", orchestrator.DefaultHealthTimeout, "How long to retry the failing health checks of each instance, whatever their retries")
+	cmd.Flags().BoolVar(&rollout.rollback, "rollback-on-failure", false, "Switch a failed batch back to its previous generation")
+
+	return withStructuredOutput(cmd)
+}
+
+// parseProjectSelector parses a selector for a command acting on the
+// current project only
+func parseProjectSelector(s string) (*orchestrator.Selector, error) {
+	selector, err := orchestrator.ParseSelector(s)
+	if err != nil {
+		return nil, err
+	}
+	if projectName := orchestrator.GetProjectName(); !selector.MatchesProject(projectName) {
+		return nil, fmt.Errorf("selector %q does not match the current project %q; select the project with --project", s, projectName)
+	}
+	return selector, nil
+}
+
+// loadMachineModules resolves the machine modules from NIXOS_MODULE_PATH
+func loadMachineModules() (*orchestrator.MachineModules, error) {
+	// Get NIXOS_MODULE_PATH from environment or inframan.json
+	nixosModulePath := orchestrator.GetNixOSModulePath()
+	if nixosModulePath == "" {
+		return nil, fmt.Errorf("NIXOS_MODULE_PATH environment variable is not set and no machine_modules is defined in %s", orchestrator.ProjectFileName)
+	}
+
+	// Verify the module file or directory exists
+	if _, err := os.Stat(nixosModulePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("NIXOS_MODULE_PATH file does not exist: %s", nixosModulePath)
+	}
+
+	// Resolve per-instance machine modules
+	modules, err := orchestrator.LoadMachineModules(nixosModulePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load machine modules: %w", err)
+	}
+
+	return modules, nil
+}
+
+// rolloutOptions configures a rolling deploy and its health gates
+type rolloutOptions struct {
+	batchSize     int
+	healthHTTP    string
+	healthTCP     int
+	healthCommand string
+	healthTimeout time.Duration
+	rollback      bool
+}
+
+// healthChecks returns the project's health checks from inframan.json
+// followed by the ones selected by the flags
+func (o *rolloutOptions) healthChecks() []orchestrator.HealthCheck {
+	checks := append([]orchestrator.HealthCheck{}, orchestrator.GetHealthChecks()...)
+	if o.healthHTTP != "" {
+		checks = append(checks, orchestrator.HealthCheck{HTTP: o.healthHTTP})
+	}
+	if o.healthTCP != 0 {
+		checks = append(checks, orchestrator.HealthCheck{TCP: o.healthTCP})
+	}
+	if o.healthCommand != "" {
+		checks = append(checks, orchestrator.HealthCheck{Command: o.healthCommand})
+	}
+	return checks
+}
+
+// validate rejects inconsistent rollout flags
+func (o *rolloutOptions) validate() error {
+	if o.batchSize < 0 {
+		return fmt.Errorf("--batch-size must not be negative")
+	}
+	for _, check := range o.healthChecks() {
+		if err := check.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.rollback && o.batchSize == 0 {
+		return fmt.Errorf("--rollback-on-failure requires --batch-size")
+	}
+	if o.rollback && len(o.healthChecks()) == 0 {
+		return fmt.Errorf("--rollback-on-failure requires health checks (--health-http, --health-tcp, --health-command or health_checks in %s)", orchestrator.ProjectFileName)
+	}
+	return nil
+}
+
+// batches splits instances into consecutive batches of at most size
+// instances. A size of 0 puts all instances in one batch.
+func batches(instances []*orchestrator.InstanceInfo, size int) [][]*orchestrator.InstanceInfo {
+	if size <= 0 || size >= len(instances) {
+		return [][]*orchestrator.InstanceInfo{instances}
+	}
+
+	var result [][]*orchestrator.InstanceInfo
+	for start := 0; start < len(instances); start += size {
+		end := start + size
+		if end > len(instances) {
+			end = len(instances)
+		}
+		result = append(result, instances[start:end])
+	}
+	return result
+}
+
+// deployInstances generates the hive for the given instances and runs
+// colmena apply, batch by batch when a rolling deploy was requested
+func deployInstances(out *output, modules *orchestrator.MachineModules, instances []*orchestrator.InstanceInfo, rollout rolloutOptions) error {
+	for _, inst := range instances {
+		fmt.Fprintf(out.progress, "Target: %-30s %s@%s\n", inst.FullName(), orchestrator.SSHUserFor(inst), instanceAddress(inst))
+	}
+
+	checks := rollout.healthChecks()
+	if err := orchestrator.ValidateHealthChecks(instances, checks); err != nil {
+		return err
+	}
+
+	// Create colmena executor
+	colmenaExec, err := orchestrator.NewColmenaExecutor()
+	if err != nil {
+		return fmt.Errorf("failed to create colmena executor: %w", err)
+	}
+	colmenaExec.SetOutput(out.progress)
+
+	// Generate dynamic hive.nix
+	fmt.Fprintln(out.progress, "Generating Colmena hive configuration...")
+	hivePath, err := colmenaExec.GenerateHive(modules, instances)
+	if err != nil {
+		return fmt.Errorf("failed to generate hive: %w", err)
+	}
+	fmt.Fprintf(out.progress, "Generated hive at: %s\n", hivePath)
+
+	if err := orchestrator.RunHooks(orchestrator.HookPreDeploy, out.progress); err != nil {
+		return err
+	}
+
+	// Run colmena apply
+	all := batches(instances, rollout.batchSize)
+	for i, batch := range all {
+		if err := deployBatch(out, colmenaExec, hivePath, batch, checks, rollout); err != nil {
+			if remaining := len(all) - i - 1; remaining > 0 {
+				return fmt.Errorf("%w; halted before the remaining %d batch(es)", err, remaining)
 			}
-			fmt.Printf("Generated hive at: %s\n", hivePath)
+			return err
+		}
+	}
+
+	fmt.Fprintln(out.progress, "Deployment completed successfully!")
+	return orchestrator.RunHooks(orchestrator.HookPostDeploy, out.progress)
+}
 
-			// Run colmena apply
-			fmt.Println("Deploying with Colmena...")
-			if err := colmenaExec.Apply(hivePath); err != nil {
-				return fmt.Errorf("colmena apply failed: %w", err)
+// deployBatch deploys one batch of instances and runs the health checks on
+// them. With rollback enabled, a batch whose colmena apply or health checks
+// fail is switched back to the generations it ran before, as some nodes may
+// have activated the new configuration before apply failed.
+func deployBatch(out *output, colmenaExec *orchestrator.ColmenaExecutor, hivePath string, batch []*orchestrator.InstanceInfo, checks []orchestrator.HealthCheck, rollout rolloutOptions) error {
+	var nodes []string
+	if rollout.batchSize > 0 {
+		nodes = make([]string, len(batch))
+		for i, inst := range batch {
+			nodes[i] = inst.NodeName()
+		}
+	}
+
+	previous := make(map[*orchestrator.InstanceInfo]int)
+	if rollout.rollback {
+		for _, inst := range batch {
+			number, err := orchestrator.CurrentGeneration(inst, orchestrator.SSHOptions{})
+			if err != nil {
+				return fmt.Errorf("cannot record generation for rollback: %w", err)
 			}
+			previous[inst] = number
+		}
+	}
 
-			fmt.Println("Deployment completed successfully!")
-			return nil
-		},
+	if len(nodes) > 0 {
+		fmt.Fprintf(out.progress, "Deploying with Colmena to %s...\n", strings.Join(instanceNames(batch), ", "))
+	} else {
+		fmt.Fprintln(out.progress, "Deploying with Colmena...")
+	}
+	if err := colmenaExec.Apply(hivePath, nodes); err != nil {
+		if rollout.rollback {
+			rollbackBatch(out.progress, batch, previous)
+		}
+		return fmt.Errorf("colmena apply failed: %w", err)
+	}
+	markChangesApplied()
+
+	if len(checks) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(out.progress, "Running health checks...")
+	failed := reportHealth(out.result, orchestrator.CheckHealth(batch, checks, rollout.healthTimeout, out.progress))
+	if failed == 0 {
+		return nil
 	}
 
-	return cmd
+	if rollout.rollback {
+		rollbackBatch(out.progress, batch, previous)
+	}
+
+	return fmt.Errorf("%d of %d instance(s) failed health checks", failed, len(batch))
+}
+
+// rollbackBatch switches every instance of a batch back to its previous
+// generation and records each rollback. Failures are reported but do not
+// stop the other instances from rolling back.
+func rollbackBatch(progress io.Writer, batch []*orchestrator.InstanceInfo, previous map[*orchestrator.InstanceInfo]int) {
+	for _, inst := range batch {
+		fmt.Fprintf(progress, "Rolling back %s to generation %d...\n", inst.FullName(), previous[inst])
+		err := orchestrator.SwitchGeneration(inst, orchestrator.SSHOptions{}, previous[inst])
+		recordHistory(inst.ProjectName, &orchestrator.HistoryEntry{
+			Command:    "rollback",
+			Instances:  []string{inst.FullName()},
+			Generation: previous[inst],
+		}, err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+}
+
+// reportHealth prints the result of every health check and returns the
+// number of instances with a failing check
+func reportHealth(w io.Writer, results []*orchestrator.HealthResult) int {
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  %-30s %-30s %s\n", "INSTANCE", "CHECK", "RESULT")
+
+	failed := make(map[*orchestrator.InstanceInfo]bool)
+	for _, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			failed[result.Instance] = true
+			status = fmt.Sprintf("failed after %d attempt(s): %v", result.Attempts, result.Err)
+		}
+		fmt.Fprintf(w, "  %-30s %-30s %s\n", result.Instance.FullName(), result.Check, status)
+	}
+	fmt.Fprintln(w)
+
+	return len(failed)
+}
+
+// States reported by deploy --check and drift
+const (
+	statusInSync      = "in sync"
+	statusDrifted     = "drifted"
+	statusUnreachable = "unreachable"
+	statusError       = "error"
+)
+
+// instanceCheck is the state of an instance as printed by deploy --check
+// with --output json or yaml
+type instanceCheck struct {
+	Instance string `json:"instance"`
+	Status   string `json:"status"`
+	Current  string `json:"current,omitempty"`
+	Expected string `json:"expected"`
+	Error    string `json:"error,omitempty"`
+}
+
+// checkInstances compares each instance's running system with the system
+// toplevel evaluated from its hive node
+func checkInstances(out *output, modules *orchestrator.MachineModules, instances []*orchestrator.InstanceInfo) error {
+	colmenaExec, err := orchestrator.NewColmenaExecutor()
+	if err != nil {
+		return fmt.Errorf("failed to create colmena executor: %w", err)
+	}
+	colmenaExec.SetOutput(out.progress)
+
+	hivePath, err := colmenaExec.GenerateHive(modules, instances)
+	if err != nil {
+		return fmt.Errorf("failed to generate hive: %w", err)
+	}
+
+	fmt.Fprintln(out.progress, "Evaluating expected system configurations...")
+	toplevels, err := colmenaExec.EvalToplevels(hivePath)
+	if err != nil {
+		return err
+	}
+
+	checks := make([]*instanceCheck, len(instances))
+	unreachable := 0
+	for i, inst := range instances {
+		expected, ok := toplevels[inst.NodeName()]
+		if !ok {
+			return fmt.Errorf("node %s missing from colmena eval output", inst.NodeName())
+		}
+		checks[i] = &instanceCheck{Instance: inst.FullName(), Status: statusInSync, Expected: expected}
+
+		current, err := orchestrator.GetCurrentSystem(inst, orchestrator.SSHOptions{})
+		checks[i].Current = current
+		switch {
+		case err != nil:
+			unreachable++
+			checks[i].Status = statusUnreachable
+			checks[i].Error = err.Error()
+		case current != expected:
+			markDriftDetected()
+			checks[i].Status = statusDrifted
+		}
+	}
+
+	if out.structured() {
+		if err := out.printResult(checks); err != nil {
+			return err
+		}
+	} else {
+		printInstanceChecks(out.result, checks)
+	}
+
+	if unreachable > 0 {
+		return fmt.Errorf("%d of %d instance(s) unreachable", unreachable, len(instances))
+	}
+	return nil
+}
+
+// printInstanceChecks prints the states of deploy --check as a table
+func printInstanceChecks(w io.Writer, checks []*instanceCheck) {
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  %-30s %-12s %s\n", "INSTANCE", "STATUS", "DETAILS")
+	for _, check := range checks {
+		switch check.Status {
+		case statusUnreachable:
+			fmt.Fprintf(w, "  %-30s %-12s %s\n", check.Instance, check.Status, check.Error)
+		case statusDrifted:
+			fmt.Fprintf(w, "  %-30s %-12s running %s, expected %s\n", check.Instance, check.Status, check.Current, check.Expected)
+		default:
+			fmt.Fprintf(w, "  %-30s %-12s %s\n", check.Instance, check.Status, check.Current)
+		}
+	}
+	fmt.Fprintln(w)
 }
@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestBatches(t *testing.T) {
+	instances := make([]*orchestrator.InstanceInfo, 5)
+	for i := range instances {
+		instances[i] = &orchestrator.InstanceInfo{ProjectName: "prod", InstanceName: string(rune('a' + i))}
+	}
+
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{size: 0, want: []int{5}},
+		{size: 2, want: []int{2, 2, 1}},
+		{size: 5, want: []int{5}},
+		{size: 10, want: []int{5}},
+	}
+
+	for _, tt := range tests {
+		got := batches(instances, tt.size)
+		if len(got) != len(tt.want) {
+			t.Fatalf("batches(size %d) = %d batches, want %d", tt.size, len(got), len(tt.want))
+		}
+		for i, batch := range got {
+			if len(batch) != tt.want[i] {
+				t.Errorf("batches(size %d)[%d] has %d instances, want %d", tt.size, i, len(batch), tt.want[i])
+			}
+		}
+	}
+}
+
+func TestDeployInstancesRollingHaltsOnFailedBatch(t *testing.T) {
+	fake := setupProject(t, "prod", `{"instances": {"value": {"web-1": "10.0.0.1", "web-2": "10.0.0.2", "web-3": "10.0.0.3"}}}`)
+	fake.On("ssh", orchestratortest.FakeResponse{Stdout: "  41   2024-03-01 10:12:45   (current)\n"})
+	fake.On(remoteCommandLine(t, "web-1", "10.0.0.1")+" curl", orchestratortest.FakeResponse{ExitCode: 7})
+
+	module := filepath.Join(t.TempDir(), "machine.nix")
+	if err := os.WriteFile(module, []byte("{ }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := orchestrator.GetInstancesForProject("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var progress bytes.Buffer
+	out, results := captureResults(outputTable)
+	out.progress = &progress
+
+	rollout := rolloutOptions{batchSize: 2, healthCommand: "curl -f localhost", rollback: true}
+	err = deployInstances(out, &orchestrator.MachineModules{Default: module}, instances, rollout)
+	if err == nil || !strings.Contains(err.Error(), "halted before the remaining 1 batch(es)") {
+		t.Fatalf("error = %v, want halted rollout", err)
+	}
+
+	var applies, switches []string
+	for _, line := range fake.CommandLines() {
+		if strings.HasPrefix(line, "colmena apply") {
+			applies = append(applies, line)
+		}
+		if strings.Contains(line, "--switch-generation 41") {
+			switches = append(switches, line)
+		}
+	}
+	if len(applies) != 1 || !strings.Contains(applies[0], "--on web-1,web-2") {
+		t.Errorf("colmena apply calls = %v, want only the first batch", applies)
+	}
+	if len(switches) != 2 {
+		t.Errorf("rollback calls = %v, want both instances of the failed batch", switches)
+	}
+
+	// Only the health report is a result; everything else is progress
+	if !strings.Contains(results.String(), "failed after") || strings.Contains(results.String(), "Deploying with Colmena") {
+		t.Errorf("results = %q, want only the health report", results.String())
+	}
+	if !strings.Contains(progress.String(), "Deploying with Colmena to prod/web-1, prod/web-2...") || !strings.Contains(progress.String(), "Rolling back prod/web-1") {
+		t.Errorf("progress = %q", progress.String())
+	}
+
+	entries, err := orchestrator.ReadHistory("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Command != "rollback" || entries[0].Generation != 41 {
+		t.Errorf("history = %+v, want two rollback entries", entries)
+	}
+}
+
+func TestDeployInstancesRollsBackFailedApply(t *testing.T) {
+	fake := setupProject(t, "prod", `{"instances": {"value": {"web-1": "10.0.0.1", "web-2": "10.0.0.2"}}}`)
+	fake.On("ssh", orchestratortest.FakeResponse{Stdout: "  41   2024-03-01 10:12:45   (current)\n"})
+	fake.On("colmena apply", orchestratortest.FakeResponse{ExitCode: 1})
+
+	module := filepath.Join(t.TempDir(), "machine.nix")
+	if err := os.WriteFile(module, []byte("{ }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	instances, err := orchestrator.GetInstancesForProject("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := captureResults(outputTable)
+	rollout := rolloutOptions{batchSize: 2, healthTCP: 22, rollback: true}
+	err = deployInstances(out, &orchestrator.MachineModules{Default: module}, instances, rollout)
+	if err == nil || !strings.Contains(err.Error(), "colmena apply failed") {
+		t.Fatalf("error = %v, want apply failure", err)
+	}
+
+	switches := 0
+	for _, line := range fake.CommandLines() {
+		if strings.Contains(line, "--switch-generation 41") {
+			switches++
+		}
+	}
+	if switches != 2 {
+		t.Errorf("rolled back %d instance(s), want both instances of the batch", switches)
+	}
+}
+
+func TestRolloutValidateRollbackRequiresHealthChecks(t *testing.T) {
+	setupProject(t, "prod", `{}`)
+
+	rollout := rolloutOptions{batchSize: 1, rollback: true}
+	if err := rollout.validate(); err == nil || !strings.Contains(err.Error(), "requires health checks") {
+		t.Errorf("validate() = %v, want missing health checks error", err)
+	}
+
+	rollout.healthTCP = 22
+	if err := rollout.validate(); err != nil {
+		t.Errorf("validate() with a health check = %v, want nil", err)
+	}
+}
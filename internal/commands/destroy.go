@@ -1,7 +1,12 @@
 package commands
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/iivel-inc/inframan/internal/orchestrator"
 	"github.com/spf13/cobra"
@@ -9,8 +14,11 @@ import (
 
 // NewDestroyCommand creates the destroy command
 func NewDestroyCommand() *cobra.Command {
+	var wait time.Duration
+	var allMatching bool
+
 	cmd := &cobra.Command{
-		Use:   "destroy",
+		Use:   "destroy [selector]",
 		Short: "Destroy infrastructure using Terraform",
 		Long: `Destroy tears down infrastructure provisioned by inframan:
 1. Runs terraform destroy in the project's terraform directory
@@ -18,29 +26,126 @@ func NewDestroyCommand() *cobra.Command {
 3. Passes through AWS credentials from environment
 
 This is the reverse of 'inframan infra' and will destroy all resources
-that were created during infrastructure provisioning.`,
+that were created during infrastructure provisioning.
+
+A selector destroys other or several projects instead of the current one,
+e.g. 'staging-*'. It must select whole projects, not instances. When it
+matches several projects, they are listed and must be confirmed by typing
+"yes", or with --non-interactive, by passing --all-matching.
+
+With --non-interactive, the destroy is not confirmed interactively and the
+exit code is 0 for nothing to destroy, 2 for destroyed and 1 for failure.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Create terraform executor
-			terraformExec, err := orchestrator.NewTerraformExecutor()
-			if err != nil {
-				return fmt.Errorf("failed to create terraform executor: %w", err)
+			out := newOutput()
+			if len(args) == 0 {
+				return destroyProject(out.progress, wait)
 			}
+			return destroyProjects(out.progress, args[0], allMatching, wait)
+		},
+	}
 
-			// Ensure terraform is initialized (needed for remote backends in CI)
-			if err := terraformExec.EnsureInit(); err != nil {
-				return fmt.Errorf("failed to initialize terraform: %w", err)
-			}
+	addWaitFlag(cmd, &wait)
+	cmd.Flags().BoolVar(&allMatching, "all-matching", false, "Destroy every project the selector matches without confirmation, even in non-interactive mode")
+
+	return cmd
+}
 
-			// Run terraform destroy
-			fmt.Println("Destroying infrastructure...")
-			if err := terraformExec.Destroy(); err != nil {
-				return fmt.Errorf("terraform destroy failed: %w", err)
+// destroyProjects destroys every project matching selector, one after the
+// other. Several projects are only destroyed once confirmed, or with
+// allMatching. The current project is restored afterwards. Progress goes to
+// progress.
+func destroyProjects(progress io.Writer, selector string, allMatching bool, wait time.Duration) error {
+	projects, err := orchestrator.SelectProjects(selector)
+	if err != nil {
+		return err
+	}
+	if len(projects) > 1 {
+		fmt.Fprintf(progress, "Selector %q matches %d projects:\n", selector, len(projects))
+		for _, project := range projects {
+			fmt.Fprintf(progress, "  %s\n", project)
+		}
+		if !allMatching {
+			if err := confirmDestroy(progress, len(projects)); err != nil {
+				return err
 			}
+		}
+	}
+
+	current := orchestrator.GetProjectName()
+	defer orchestrator.SetProjectName(current)
 
-			fmt.Println("Infrastructure destroyed successfully!")
+	for _, project := range projects {
+		fmt.Fprintf(progress, "Destroying project %q...\n", project)
+		orchestrator.SetProjectName(project)
+		if err := destroyProject(progress, wait); err != nil {
+			return fmt.Errorf("project %q: %w", project, err)
+		}
+	}
+	return nil
+}
+
+// confirmDestroy asks on progress to confirm destroying several projects. In
+// non-interactive mode there is no one to ask, so it fails.
+func confirmDestroy(progress io.Writer, count int) error {
+	if orchestrator.IsNonInteractive() {
+		return fmt.Errorf("refusing to destroy %d projects in non-interactive mode; pass --all-matching to destroy them all", count)
+	}
+
+	fmt.Fprintf(progress, "Destroy all %d projects? Type \"yes\" to confirm: ", count)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		return fmt.Errorf("destroy cancelled")
+	}
+	return nil
+}
+
+// destroyProject destroys the current project's infrastructure, writing
+// progress and terraform output to progress
+func destroyProject(progress io.Writer, wait time.Duration) (err error) {
+	release, err := lockProject("destroy", wait)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Record the instances as they were before destroying them
+	entry := &orchestrator.HistoryEntry{Command: "destroy", Instances: currentInstanceNames()}
+	defer func() { recordHistory(orchestrator.GetProjectName(), entry, err) }()
+
+	// Create terraform executor
+	terraformExec, err := orchestrator.NewTerraformExecutor()
+	if err != nil {
+		return fmt.Errorf("failed to create terraform executor: %w", err)
+	}
+	terraformExec.SetOutput(progress)
+
+	// Ensure terraform is initialized (needed for remote backends in CI)
+	if err := terraformExec.EnsureInit(); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %w", err)
+	}
+
+	if err := orchestrator.RunHooks(orchestrator.HookPreDestroy, progress); err != nil {
+		return err
+	}
+
+	// Run terraform destroy
+	fmt.Fprintln(progress, "Destroying infrastructure...")
+	if orchestrator.IsNonInteractive() {
+		changed, err := terraformExec.ApplyChanges(true)
+		if err != nil {
+			return fmt.Errorf("terraform destroy failed: %w", err)
+		}
+		if !changed {
+			fmt.Fprintln(progress, "No changes. Nothing to destroy.")
 			return nil
-		},
+		}
+	} else if err := terraformExec.Destroy(); err != nil {
+		return fmt.Errorf("terraform destroy failed: %w", err)
 	}
+	markChangesApplied()
 
-	return cmd
+	fmt.Fprintln(progress, "Infrastructure destroyed successfully!")
+	refreshSSHConfig()
+	return orchestrator.RunHooks(orchestrator.HookPostDestroy, progress)
 }
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+)
+
+func TestDestroyProjectsRequiresAllMatching(t *testing.T) {
+	fake := setupProject(t, "staging-a", `{}`)
+	t.Setenv("INFRAMAN_NON_INTERACTIVE", "1")
+	t.Cleanup(func() { orchestrator.SetProjectName("") })
+	terraformDir, err := orchestrator.GetTerraformDirForProject("staging-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(terraformDir, ".terraform"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	orchestrator.SetProjectName("prod")
+
+	err = destroyProjects(io.Discard, "staging-*", false, 0)
+	if err == nil || !strings.Contains(err.Error(), "--all-matching") {
+		t.Fatalf("destroyProjects() error = %v, want --all-matching required", err)
+	}
+	for _, line := range fake.CommandLines() {
+		if strings.Contains(line, "-destroy") {
+			t.Fatalf("destroyed without --all-matching: %s", line)
+		}
+	}
+
+	if err := destroyProjects(io.Discard, "staging-*", true, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	destroys := 0
+	for _, line := range fake.CommandLines() {
+		if strings.Contains(line, "-destroy") {
+			destroys++
+		}
+	}
+	if destroys != 2 {
+		t.Errorf("got %d destroy plans, want 2:\n%s", destroys, strings.Join(fake.CommandLines(), "\n"))
+	}
+	if got := orchestrator.GetProjectName(); got != "prod" {
+		t.Errorf("project = %q after destroy, want prod restored", got)
+	}
+}
@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// projectDrift is the drift check result of one project
+type projectDrift struct {
+	Project string
+	Drifted bool
+	Drift   []*orchestrator.ResourceChange
+	Err     error
+}
+
+// NewDriftCommand creates the drift command
+func NewDriftCommand() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "drift [project...]",
+		Short: "Detect infrastructure drift from the terraform state",
+		Long: `Drift checks whether live infrastructure still matches the terraform state
+by running a refresh-only plan, without changing anything.
+
+Checks the current project by default, the given projects, or every project
+under .inframan/ with --all.
+
+Exit codes:
+  0 - no drift
+  1 - a project could not be checked
+  2 - drift detected
+
+Examples:
+  # Nightly check of every project
+  inframan drift --all --non-interactive`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := newOutput()
+
+			projects := args
+			if all {
+				var err error
+				projects, err = orchestrator.GetAllProjectDirs()
+				if err != nil {
+					return fmt.Errorf("failed to list projects: %w", err)
+				}
+				if len(projects) == 0 && !out.structured() {
+					fmt.Fprintln(out.result, "No projects found.")
+					return nil
+				}
+			} else if len(projects) == 0 {
+				projects = []string{orchestrator.GetProjectName()}
+			}
+
+			var results []*projectDrift
+			for _, project := range projects {
+				fmt.Fprintf(out.progress, "Checking %s for drift...\n", project)
+				results = append(results, checkProjectDrift(out.progress, project))
+			}
+
+			return reportDrift(out, results)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&all, "all", "a", false, "Check every project under .inframan/")
+
+	return withStructuredOutput(cmd)
+}
+
+// checkProjectDrift runs a refresh-only plan for a project under its lock,
+// writing terraform output to progress
+func checkProjectDrift(progress io.Writer, project string) *projectDrift {
+	result := &projectDrift{Project: project}
+
+	// Checking an unknown project would create it and report it in sync
+	exists, err := orchestrator.ProjectExists(project)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if !exists {
+		result.Err = fmt.Errorf("unknown project %q (not found under .inframan/)", project)
+		return result
+	}
+
+	lock, err := orchestrator.AcquireLock(project, "drift", 0)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer lock.Release()
+
+	terraformExec, err := orchestrator.NewTerraformExecutorForProject(project)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create terraform executor: %w", err)
+		return result
+	}
+	terraformExec.SetOutput(progress)
+
+	result.Drifted, result.Drift, result.Err = terraformExec.DetectDrift()
+	return result
+}
+
+// driftRecord is the drift of a project as printed with --output json or yaml
+type driftRecord struct {
+	Project string                  `json:"project"`
+	Status  string                  `json:"status"`
+	Drift   []*resourceChangeRecord `json:"drift"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+// reportDrift prints a per-project drift summary and sets the exit status
+func reportDrift(out *output, results []*projectDrift) error {
+	records := make([]*driftRecord, len(results))
+	failed := 0
+	for i, r := range results {
+		records[i] = &driftRecord{Project: r.Project, Status: statusInSync, Drift: resourceChangeRecords(r.Drift)}
+		switch {
+		case r.Err != nil:
+			failed++
+			records[i].Status = statusError
+			records[i].Error = r.Err.Error()
+		case r.Drifted:
+			markDriftDetected()
+			records[i].Status = statusDrifted
+		}
+	}
+
+	if out.structured() {
+		if err := out.printResult(records); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(out.result)
+		fmt.Fprintf(out.result, "  %-20s %-10s %s\n", "PROJECT", "STATUS", "DRIFTED")
+		for _, record := range records {
+			if record.Error != "" {
+				fmt.Fprintf(out.result, "  %-20s %-10s %s\n", record.Project, record.Status, record.Error)
+				continue
+			}
+			fmt.Fprintf(out.result, "  %-20s %-10s %d\n", record.Project, record.Status, len(record.Drift))
+			for _, d := range record.Drift {
+				fmt.Fprintf(out.result, "      %-8s %s\n", d.Action, d.Address)
+			}
+		}
+		fmt.Fprintln(out.result)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("drift check failed for %d of %d project(s)", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+)
+
+func TestCheckProjectDriftUnknownProject(t *testing.T) {
+	fake := setupProject(t, "prod", `{}`)
+
+	result := checkProjectDrift(io.Discard, "typo")
+	if result.Err == nil || !strings.Contains(result.Err.Error(), `unknown project "typo"`) {
+		t.Fatalf("error = %v, want unknown project", result.Err)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Errorf("ran %v, want no terraform commands", fake.CommandLines())
+	}
+
+	inframanDir, err := orchestrator.GetInframanDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(inframanDir, "typo")); !os.IsNotExist(err) {
+		t.Errorf("unknown project directory was created: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// NewExecCommand creates the exec command
+func NewExecCommand() *cobra.Command {
+	var parallel int
+	var timeout time.Duration
+	var user string
+	var identityFile string
+
+	cmd := &cobra.Command{
+		Use:   "exec <selector> -- <command>",
+		Short: "Run a command on every matching instance",
+		Long: `Exec runs a shell command over SSH on every instance matching the selector,
+up to --parallel instances at a time. Output is streamed line by line,
+prefixed with the instance name, and a summary of exit statuses is printed
+at the end. The exit code is 1 if the command failed, timed out or could not
+be run on any instance.
+
+With --output json or yaml, the summary is printed as JSON or YAML on stdout
+and the command's own output is streamed to stderr.
+
+The selector is a project, project/instance, a glob such as prod/web-* or
+prod-*/db-1, or a tag from instance_tags such as @canary or prod/@role=db.
+
+Examples:
+  # Check uptime on every instance of a project
+  inframan exec production -- uptime
+
+  # Restart nginx on the web servers, two at a time
+  inframan exec 'production/web-*' --parallel 2 -- systemctl restart nginx
+
+  # Vacuum every database, selected by tag
+  inframan exec 'production/@role=db' -- sudo -u postgres vacuumdb --all`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if cmd.ArgsLenAtDash() != 1 || len(args) < 2 {
+				return fmt.Errorf("usage: inframan exec <selector> -- <command>")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if parallel < 0 {
+				return fmt.Errorf("--parallel must not be negative")
+			}
+
+			instances, err := orchestrator.SelectInstances(args[0])
+			if err != nil {
+				return err
+			}
+
+			// With json or yaml, stdout holds only the summary
+			out := newOutput()
+			stdout := out.result
+			if out.structured() {
+				stdout = out.progress
+			}
+
+			opts := orchestrator.SSHOptions{User: user, IdentityFile: identityFile}
+			results := execOnInstances(stdout, instances, opts, strings.Join(args[1:], " "), parallel, timeout)
+			return reportExec(out, results)
+		},
+	}
+
+	cmd.Flags().IntVar(&parallel, "parallel", 10, "Run on at most this many instances at a time (0 for all)")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Kill the command on an instance after this long (e.g. 30s)")
+	cmd.Flags().StringVarP(&user, "user", "u", "", "SSH user (default: the instance's ssh_user, SSH_USER or inframan.json, else root)")
+	cmd.Flags().StringVarP(&identityFile, "identity", "i", "", "Path to SSH identity file")
+
+	return withStructuredOutput(cmd)
+}
+
+// execResult is the outcome of a command on one instance
+type execResult struct {
+	instance *orchestrator.InstanceInfo
+	code     int
+	err      error
+}
+
+// execOnInstances runs a command on every instance, at most parallel at a
+// time, streaming prefixed output to stdout and stderr
+func execOnInstances(stdout io.Writer, instances []*orchestrator.InstanceInfo, opts orchestrator.SSHOptions, command string, parallel int, timeout time.Duration) []*execResult {
+	if parallel == 0 || parallel > len(instances) {
+		parallel = len(instances)
+	}
+
+	width := 0
+	for _, inst := range instances {
+		if len(inst.FullName()) > width {
+			width = len(inst.FullName())
+		}
+	}
+
+	var mu sync.Mutex
+	results := make([]*execResult, len(instances))
+	slots := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i, inst := range instances {
+		wg.Add(1)
+		go func(i int, inst *orchestrator.InstanceInfo) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			prefix := fmt.Sprintf("%-*s | ", width, inst.FullName())
+			instStdout := &prefixWriter{w: stdout, prefix: prefix, mu: &mu}
+			instStderr := &prefixWriter{w: os.Stderr, prefix: prefix, mu: &mu}
+
+			code, err := orchestrator.StreamRemote(inst, opts, command, instStdout, instStderr, timeout)
+			instStdout.Flush()
+			instStderr.Flush()
+			results[i] = &execResult{instance: inst, code: code, err: err}
+		}(i, inst)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// execRecord is the outcome of a command on one instance as printed with
+// --output json or yaml
+type execRecord struct {
+	Instance string `json:"instance"`
+	Status   string `json:"status"` // ok, failed or error
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// reportExec prints the exit status of every instance and returns an error
+// if the command did not succeed everywhere
+func reportExec(out *output, results []*execResult) error {
+	records := make([]*execRecord, len(results))
+	failed := 0
+	for i, result := range results {
+		records[i] = &execRecord{Instance: result.instance.FullName(), Status: "ok", ExitCode: result.code}
+		switch {
+		case result.err != nil:
+			failed++
+			records[i].Status = "error"
+			records[i].Error = result.err.Error()
+		case result.code != 0:
+			failed++
+			records[i].Status = "failed"
+		}
+	}
+
+	if out.structured() {
+		if err := out.printResult(records); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(out.result)
+		fmt.Fprintf(out.result, "  %-30s %s\n", "INSTANCE", "RESULT")
+		for _, record := range records {
+			status := record.Status
+			switch {
+			case record.Error != "":
+				status = record.Error
+			case record.ExitCode != 0:
+				status = fmt.Sprintf("exit status %d", record.ExitCode)
+			}
+			fmt.Fprintf(out.result, "  %-30s %s\n", record.Instance, status)
+		}
+		fmt.Fprintln(out.result)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("command failed on %d of %d instance(s)", failed, len(results))
+	}
+	return nil
+}
+
+// prefixWriter writes complete lines to w, each prefixed with prefix. Writers
+// sharing mu never interleave their lines.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+}
+
+// Write buffers data and writes out every complete line
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf.Write(data)
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(data), nil
+		}
+		if err := p.writeLine(string(p.buf.Next(i + 1))); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Flush writes out a trailing line without newline
+func (p *prefixWriter) Flush() {
+	if p.buf.Len() > 0 {
+		p.writeLine(string(p.buf.Next(p.buf.Len())) + "\n")
+	}
+}
+
+// writeLine writes one prefixed line
+func (p *prefixWriter) writeLine(line string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+	return err
+}
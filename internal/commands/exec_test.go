@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{w: &out, prefix: "web-1 | ", mu: &sync.Mutex{}}
+
+	w.Write([]byte("first\nsec"))
+	w.Write([]byte("ond\nthird"))
+	w.Flush()
+
+	want := "web-1 | first\nweb-1 | second\nweb-1 | third\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestExecOnInstances(t *testing.T) {
+	fake := setupProject(t, "prod", `{"instances": {"value": {"web-1": "10.0.0.1", "web-2": "10.0.0.2"}}}`)
+	fake.On("ssh", orchestratortest.FakeResponse{Stdout: "up 3 days\n"})
+	fake.On(remoteCommandLine(t, "web-2", "10.0.0.2"), orchestratortest.FakeResponse{ExitCode: 3})
+
+	instances, err := orchestrator.SelectInstances("prod/web-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	results := execOnInstances(&stdout, instances, orchestrator.SSHOptions{}, "uptime", 1, 0)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].code != 0 || results[0].err != nil {
+		t.Errorf("web-1 result = %+v, want success", results[0])
+	}
+	if results[1].code != 3 || results[1].err != nil {
+		t.Errorf("web-2 result = %+v, want exit status 3", results[1])
+	}
+
+	if !strings.Contains(stdout.String(), "prod/web-1 | up 3 days\n") {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+
+	out, buf := captureResults(outputJSON)
+	err = reportExec(out, results)
+	if err == nil || !strings.Contains(err.Error(), "failed on 1 of 2") {
+		t.Errorf("reportExec() error = %v", err)
+	}
+	var records []*execRecord
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("output is not a JSON list of results: %v\n%s", err, buf.String())
+	}
+	if len(records) != 2 || records[0].Status != "ok" || records[1].Status != "failed" || records[1].ExitCode != 3 {
+		t.Errorf("records = %+v %+v, want ok and failed with exit status 3", records[0], records[1])
+	}
+
+	for _, line := range fake.CommandLines() {
+		if strings.HasPrefix(line, "ssh") && !strings.HasSuffix(line, " uptime") {
+			t.Errorf("command = %q, want uptime", line)
+		}
+	}
+}
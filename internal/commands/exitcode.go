@@ -0,0 +1,51 @@
+package commands
+
+import "github.com/iivel-inc/inframan/internal/orchestrator"
+
+// Exit codes reported in non-interactive mode, following terraform's
+// -detailed-exitcode convention
+const (
+	// ExitNoChanges means the command succeeded without changing anything
+	ExitNoChanges = 0
+
+	// ExitFailed means the command failed
+	ExitFailed = 1
+
+	// ExitChangesApplied means the command succeeded and applied changes
+	ExitChangesApplied = 2
+
+	// ExitDriftDetected means a drift check succeeded and found drift
+	ExitDriftDetected = 2
+)
+
+// changesApplied is set by commands that changed infrastructure or hosts
+var changesApplied bool
+
+// driftDetected is set by drift checks that found drift
+var driftDetected bool
+
+// markDriftDetected records that the running command found drift
+func markDriftDetected() {
+	driftDetected = true
+}
+
+// markChangesApplied records that the running command applied changes
+func markChangesApplied() {
+	changesApplied = true
+}
+
+// ExitCode maps the result of a command to the process exit code.
+// Drift checks exit with ExitDriftDetected whenever drift is found; otherwise,
+// outside non-interactive mode every successful run exits with 0.
+func ExitCode(err error) int {
+	if err != nil {
+		return ExitFailed
+	}
+	if driftDetected {
+		return ExitDriftDetected
+	}
+	if changesApplied && orchestrator.IsNonInteractive() {
+		return ExitChangesApplied
+	}
+	return ExitNoChanges
+}
@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// NewHistoryCommand creates the history command
+func NewHistoryCommand() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "history [entry]",
+		Short: "Show what was deployed to the project and when",
+		Long: `History lists the infra, deploy, destroy, up and rollback runs recorded for
+the current project in .inframan/<project>/history.jsonl, newest last.
+
+Each entry records the time, user, git commit of the workspace, hash of
+config.tf.json, module path, target instances and outcome. Pass an entry
+number to show a single entry in full.
+
+Examples:
+  # List the last 20 runs
+  inframan history
+
+  # Show entry 12 of the production project as JSON
+  inframan history 12 --project production --output json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := newOutput()
+			projectName := orchestrator.GetProjectName()
+			entries, err := orchestrator.ReadHistory(projectName)
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 1 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 || n > len(entries) {
+					return fmt.Errorf("no history entry %q for project %q (%d entries)", args[0], projectName, len(entries))
+				}
+				return showHistoryEntry(out, n, entries[n-1])
+			}
+
+			return listHistory(out, projectName, entries, limit)
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of most recent entries to list (0 for all)")
+
+	return withStructuredOutput(cmd)
+}
+
+// listHistory prints the most recent history entries, numbered from the oldest
+func listHistory(out *output, projectName string, entries []*orchestrator.HistoryEntry, limit int) error {
+	first := 0
+	if limit > 0 && len(entries) > limit {
+		first = len(entries) - limit
+	}
+
+	if out.structured() {
+		// Print an empty list rather than null
+		return out.printResult(append([]*orchestrator.HistoryEntry{}, entries[first:]...))
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintf(out.result, "No history for project %q.\n", projectName)
+		return nil
+	}
+
+	fmt.Fprintf(out.result, "  %-4s %-19s %-12s %-9s %-9s %-13s %s\n", "#", "TIME", "USER", "COMMAND", "OUTCOME", "COMMIT", "INSTANCES")
+	for i := first; i < len(entries); i++ {
+		entry := entries[i]
+		fmt.Fprintf(out.result, "  %-4d %-19s %-12s %-9s %-9s %-13s %s\n",
+			i+1,
+			entry.Time.Local().Format("2006-01-02 15:04:05"),
+			entry.User,
+			entry.Command,
+			entry.Outcome,
+			shortCommit(entry.GitCommit),
+			strings.Join(entry.Instances, ", "),
+		)
+	}
+
+	return nil
+}
+
+// showHistoryEntry prints every field of a history entry
+func showHistoryEntry(out *output, n int, entry *orchestrator.HistoryEntry) error {
+	if out.structured() {
+		return out.printResult(entry)
+	}
+
+	generation := ""
+	if entry.Generation != 0 {
+		generation = strconv.Itoa(entry.Generation)
+	}
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"Entry", strconv.Itoa(n)},
+		{"Time", entry.Time.Local().Format("2006-01-02 15:04:05 MST")},
+		{"User", entry.User},
+		{"Command", entry.Command},
+		{"Outcome", entry.Outcome},
+		{"Error", entry.Error},
+		{"Git commit", entry.GitCommit},
+		{"Config hash", entry.ConfigHash},
+		{"Module path", entry.ModulePath},
+		{"Instances", strings.Join(entry.Instances, ", ")},
+		{"Generation", generation},
+	}
+
+	for _, field := range fields {
+		if field.value != "" {
+			fmt.Fprintf(out.result, "%-12s %s\n", field.name+":", field.value)
+		}
+	}
+	return nil
+}
+
+// shortCommit abbreviates a commit hash, keeping the -dirty suffix
+func shortCommit(commit string) string {
+	hash := strings.TrimSuffix(commit, "-dirty")
+	if len(hash) > 7 {
+		return hash[:7] + commit[len(hash):]
+	}
+	return commit
+}
+
+// recordHistory appends an entry to a project's history. Failing to record
+// history does not fail the command.
+func recordHistory(projectName string, entry *orchestrator.HistoryEntry, err error) {
+	if histErr := orchestrator.RecordHistory(projectName, entry, err); histErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", histErr)
+	}
+}
+
+// instanceNames returns the full names of instances
+func instanceNames(instances []*orchestrator.InstanceInfo) []string {
+	names := make([]string, len(instances))
+	for i, inst := range instances {
+		names[i] = inst.FullName()
+	}
+	return names
+}
+
+// currentInstanceNames returns the full names of the current project's
+// instances, or nil if they cannot be read from the terraform outputs
+func currentInstanceNames() []string {
+	instances, err := orchestrator.GetInstancesForProject(orchestrator.GetProjectName())
+	if err != nil {
+		return nil
+	}
+	return instanceNames(instances)
+}
@@ -0,0 +1,17 @@
+package commands
+
+import "testing"
+
+func TestShortCommit(t *testing.T) {
+	tests := map[string]string{
+		"":                       "",
+		"0123456789abcdef":       "0123456",
+		"0123456789abcdef-dirty": "0123456-dirty",
+		"abc":                    "abc",
+	}
+	for commit, want := range tests {
+		if got := shortCommit(commit); got != want {
+			t.Errorf("shortCommit(%q) = %q, want %q", commit, got, want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// NewHostKeysCommand creates the hostkeys command
+func NewHostKeysCommand() *cobra.Command {
+	var reset bool
+
+	cmd := &cobra.Command{
+		Use:   "hostkeys [selector]",
+		Short: "List or reset pinned SSH host keys",
+		Long: `Hostkeys lists the SSH host keys pinned in .inframan/<project>/known_hosts
+for the instances matching the selector (default: all projects).
+
+ssh, exec, rollback and deploy verify every connection against these keys.
+Keys from the host_key field of the instances terraform output are pinned
+before connecting; other keys are pinned on first connection. A changed key
+fails the connection until the old key is removed with --reset, e.g. after
+an instance was replaced.
+
+Examples:
+  # List the pinned keys of a project
+  inframan hostkeys production
+
+  # Forget the key of a replaced instance
+  inframan hostkeys --reset production/db-1`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if reset && len(args) == 0 {
+				return fmt.Errorf("--reset requires a selector")
+			}
+
+			selector := "*"
+			if len(args) == 1 {
+				selector = args[0]
+			}
+			out := newOutput()
+			if reset {
+				if err := out.tableOnly("hostkeys --reset"); err != nil {
+					return err
+				}
+				return resetHostKeys(selector)
+			}
+			return listHostKeys(out, selector)
+		},
+	}
+
+	cmd.Flags().BoolVar(&reset, "reset", false, "Remove the pinned keys of the matching instances")
+
+	return withStructuredOutput(cmd)
+}
+
+// hostKeyRecord is a pinned host key as listed with --output json or yaml
+type hostKeyRecord struct {
+	Instance    string `json:"instance"`
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Fingerprint string `json:"fingerprint"`
+	Key         string `json:"key"`
+}
+
+// hostKeyMatcher returns a function reporting whether a known_hosts entry
+// of a project belongs to an instance matching selector. Only tag selectors
+// need the instances from terraform output, so keys of instances that no
+// longer exist can be listed and removed as well.
+func hostKeyMatcher(selector string) (*orchestrator.Selector, func(project, host string) bool, error) {
+	s, err := orchestrator.ParseSelector(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.Tag == "" {
+		return s, func(project, host string) bool {
+			inst := &orchestrator.InstanceInfo{ProjectName: project}
+			if i := strings.Index(host, "/"); i >= 0 {
+				inst.ProjectName, inst.InstanceName = host[:i], host[i+1:]
+			}
+			return inst.ProjectName == project && s.Match(inst)
+		}, nil
+	}
+
+	instances, err := orchestrator.SelectInstances(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := make(map[string]bool)
+	for _, inst := range instances {
+		selected[orchestrator.HostKeyAlias(inst)] = true
+	}
+	return s, func(project, host string) bool {
+		return selected[host]
+	}, nil
+}
+
+// hostKeyProjects returns the projects whose known_hosts the selector covers
+func hostKeyProjects(s *orchestrator.Selector) ([]string, error) {
+	all, err := orchestrator.GetAllProjectDirs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+
+	var projects []string
+	for _, project := range all {
+		if s.MatchesProject(project) {
+			projects = append(projects, project)
+		}
+	}
+	return projects, nil
+}
+
+// listHostKeys prints the pinned host keys of the instances matching selector
+func listHostKeys(out *output, selector string) error {
+	s, match, err := hostKeyMatcher(selector)
+	if err != nil {
+		return err
+	}
+	projects, err := hostKeyProjects(s)
+	if err != nil {
+		return err
+	}
+
+	var entries []*orchestrator.HostKeyEntry
+	for _, project := range projects {
+		projectEntries, err := orchestrator.ReadKnownHosts(project)
+		if err != nil {
+			return fmt.Errorf("project %q: %w", project, err)
+		}
+		for _, entry := range projectEntries {
+			if match(project, entry.Host) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	records := make([]*hostKeyRecord, len(entries))
+	for i, entry := range entries {
+		records[i] = &hostKeyRecord{Instance: entry.Host, Type: entry.Type, Source: "first use", Fingerprint: entry.Fingerprint(), Key: entry.Key}
+		if entry.FromTerraform() {
+			records[i].Source = "terraform"
+		}
+	}
+	if out.structured() {
+		return out.printResult(records)
+	}
+
+	if len(records) == 0 {
+		fmt.Fprintf(out.result, "No host keys pinned for %q.\n", selector)
+		return nil
+	}
+
+	fmt.Fprintf(out.result, "  %-30s %-20s %-10s %s\n", "INSTANCE", "TYPE", "SOURCE", "FINGERPRINT")
+	for _, record := range records {
+		fmt.Fprintf(out.result, "  %-30s %-20s %-10s %s\n", record.Instance, record.Type, record.Source, record.Fingerprint)
+	}
+	return nil
+}
+
+// resetHostKeys removes the pinned host keys of the instances matching selector
+func resetHostKeys(selector string) error {
+	s, match, err := hostKeyMatcher(selector)
+	if err != nil {
+		return err
+	}
+	projects, err := hostKeyProjects(s)
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, project := range projects {
+		entries, err := orchestrator.RemoveHostKeys(project, func(host string) bool {
+			return match(project, host)
+		})
+		if err != nil {
+			return fmt.Errorf("project %q: %w", project, err)
+		}
+		for _, entry := range entries {
+			fmt.Printf("Removed host key of %s (%s %s)\n", entry.Host, entry.Type, entry.Fingerprint())
+		}
+		removed += len(entries)
+	}
+
+	if removed == 0 {
+		fmt.Printf("No host keys pinned for %q.\n", selector)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+)
+
+func TestResetHostKeys(t *testing.T) {
+	setupProject(t, "prod", `{"instances": {"value": {"web-1": "10.0.0.1", "db-1": "10.0.0.2"}}}`)
+	path, err := orchestrator.GetKnownHostsPath("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// db-2 no longer exists in terraform output
+	known := "prod/web-1 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIA==\nprod/db-1 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIB==\nprod/db-2 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIC==\n"
+	if err := os.WriteFile(path, []byte(known), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := resetHostKeys("prod/db-*"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := orchestrator.ReadKnownHosts("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Host != "prod/web-1" {
+		t.Errorf("known_hosts after reset = %v, want only prod/web-1", entries)
+	}
+}
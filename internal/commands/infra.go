@@ -2,7 +2,9 @@ package commands
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"github.com/iivel-inc/inframan/internal/orchestrator"
 	"github.com/spf13/cobra"
@@ -10,60 +12,200 @@ import (
 
 // NewInfraCommand creates the infra command
 func NewInfraCommand() *cobra.Command {
+	var planFile string
+	var wait time.Duration
+
 	cmd := &cobra.Command{
 		Use:   "infra",
 		Short: "Apply infrastructure using Terranix and Terraform",
 		Long: `Infra orchestrates infrastructure provisioning:
-1. Reads the Terranix JSON config from INFRA_CONFIG_JSON env var
+1. Reads the Terranix JSON config from INFRA_CONFIG_JSON (or inframan.json)
 2. Copies config to .inframan/terraform/config.tf.json
 3. Runs terraform init and terraform apply
-4. Passes through AWS credentials from environment`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// Get INFRA_CONFIG_JSON from environment
-			infraConfigJSON := os.Getenv("INFRA_CONFIG_JSON")
-			if infraConfigJSON == "" {
-				return fmt.Errorf("INFRA_CONFIG_JSON environment variable is not set")
-			}
+4. Passes through AWS credentials from environment
 
-			// Verify the config file exists
-			if _, err := os.Stat(infraConfigJSON); os.IsNotExist(err) {
-				return fmt.Errorf("INFRA_CONFIG_JSON file does not exist: %s", infraConfigJSON)
-			}
+With --plan-file, infra applies exactly a plan saved by 'inframan plan'
+instead, and refuses if the config changed since the plan was created.
 
-			// Create terranix executor to copy config
-			terranixExec, err := orchestrator.NewTerranixExecutor()
+With --non-interactive, terraform never prompts (-auto-approve -input=false)
+and the exit code is 0 for no changes, 2 for changes applied and 1 for failure.`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			release, err := lockProject("infra", wait)
 			if err != nil {
-				return fmt.Errorf("failed to create terranix executor: %w", err)
+				return err
 			}
+			defer release()
 
-			// Setup workdir and copy config
-			fmt.Println("Setting up infrastructure workspace...")
-			if _, err := terranixExec.BuildFromConfig(infraConfigJSON); err != nil {
-				return fmt.Errorf("failed to setup workdir: %w", err)
-			}
-
-			// Create terraform executor
-			terraformExec, err := orchestrator.NewTerraformExecutor()
-			if err != nil {
-				return fmt.Errorf("failed to create terraform executor: %w", err)
-			}
+			entry := &orchestrator.HistoryEntry{Command: "infra"}
+			defer func() {
+				if err == nil {
+					entry.Instances = currentInstanceNames()
+				}
+				recordHistory(orchestrator.GetProjectName(), entry, err)
+			}()
 
-			// Run terraform init
-			fmt.Println("Initializing Terraform...")
-			if err := terraformExec.Init(); err != nil {
-				return fmt.Errorf("terraform init failed: %w", err)
+			out := newOutput()
+			if planFile != "" {
+				return applyPlanFile(out.progress, planFile)
 			}
 
-			// Run terraform apply
-			fmt.Println("Applying infrastructure...")
-			if err := terraformExec.Apply(); err != nil {
-				return fmt.Errorf("terraform apply failed: %w", err)
+			terraformExec, err := setupInfraWorkspace(out.progress)
+			if err != nil {
+				return err
 			}
 
-			fmt.Println("Infrastructure applied successfully!")
-			return nil
+			return applyInfra(out.progress, terraformExec)
 		},
 	}
 
+	addWaitFlag(cmd, &wait)
+	cmd.Flags().StringVar(&planFile, "plan-file", "", "Apply a plan saved by 'inframan plan' (relative to .inframan/<project>/terraform/)")
+
 	return cmd
 }
+
+// getInfraConfigJSON returns the Terranix JSON config path after checking it exists
+func getInfraConfigJSON() (string, error) {
+	infraConfigJSON := orchestrator.GetInfraConfigPath()
+	if infraConfigJSON == "" {
+		return "", fmt.Errorf("INFRA_CONFIG_JSON environment variable is not set and no infra_config is defined in %s", orchestrator.ProjectFileName)
+	}
+
+	// Verify the config file exists
+	if _, err := os.Stat(infraConfigJSON); os.IsNotExist(err) {
+		return "", fmt.Errorf("INFRA_CONFIG_JSON file does not exist: %s", infraConfigJSON)
+	}
+
+	return infraConfigJSON, nil
+}
+
+// setupInfraWorkspace copies the Terranix config into the project's terraform
+// directory and runs terraform init, writing progress and terraform output to
+// progress
+func setupInfraWorkspace(progress io.Writer) (*orchestrator.TerraformExecutor, error) {
+	infraConfigJSON, err := getInfraConfigJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	// Create terranix executor to copy config
+	terranixExec, err := orchestrator.NewTerranixExecutor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create terranix executor: %w", err)
+	}
+
+	// Setup workdir and copy config
+	fmt.Fprintln(progress, "Setting up infrastructure workspace...")
+	if _, err := terranixExec.BuildFromConfig(infraConfigJSON); err != nil {
+		return nil, fmt.Errorf("failed to setup workdir: %w", err)
+	}
+
+	// Create terraform executor
+	terraformExec, err := orchestrator.NewTerraformExecutor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create terraform executor: %w", err)
+	}
+	terraformExec.SetOutput(progress)
+
+	// Run terraform init
+	fmt.Fprintln(progress, "Initializing Terraform...")
+	if err := terraformExec.Init(); err != nil {
+		return nil, fmt.Errorf("terraform init failed: %w", err)
+	}
+
+	return terraformExec, nil
+}
+
+// applyInfra runs terraform apply in an initialized workspace. In
+// non-interactive mode it plans first so that "no changes" can be reported.
+// The SSH config refresh and post_infra hooks run whether or not anything
+// changed, as in interactive mode. Progress and terraform output go to
+// progress.
+func applyInfra(progress io.Writer, terraformExec *orchestrator.TerraformExecutor) error {
+	if err := orchestrator.RunHooks(orchestrator.HookPreInfra, progress); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(progress, "Applying infrastructure...")
+	changed := true
+	if orchestrator.IsNonInteractive() {
+		var err error
+		if changed, err = terraformExec.ApplyChanges(false); err != nil {
+			return fmt.Errorf("terraform apply failed: %w", err)
+		}
+	} else if err := terraformExec.Apply(); err != nil {
+		return fmt.Errorf("terraform apply failed: %w", err)
+	}
+
+	if changed {
+		markChangesApplied()
+		fmt.Fprintln(progress, "Infrastructure applied successfully!")
+	} else {
+		fmt.Fprintln(progress, "No changes. Infrastructure is up-to-date.")
+	}
+	refreshSSHConfig()
+	return orchestrator.RunHooks(orchestrator.HookPostInfra, progress)
+}
+
+// applyPlanFile applies a saved plan after verifying that neither the source
+// config nor the workspace config changed since the plan was created.
+// Progress and terraform output go to progress.
+func applyPlanFile(progress io.Writer, planFile string) error {
+	infraConfigJSON, err := getInfraConfigJSON()
+	if err != nil {
+		return err
+	}
+
+	terraformExec, err := orchestrator.NewTerraformExecutor()
+	if err != nil {
+		return fmt.Errorf("failed to create terraform executor: %w", err)
+	}
+	terraformExec.SetOutput(progress)
+
+	planPath := terraformExec.GetPlanPath(planFile)
+	if _, err := os.Stat(planPath); os.IsNotExist(err) {
+		return fmt.Errorf("plan file does not exist: %s", planPath)
+	}
+
+	meta, err := orchestrator.ReadPlanMeta(planPath)
+	if err != nil {
+		return err
+	}
+
+	for _, configPath := range []string{infraConfigJSON, terraformExec.GetConfigPath()} {
+		configHash, err := orchestrator.HashFile(configPath)
+		if err != nil {
+			return err
+		}
+		if configHash != meta.ConfigHash {
+			return fmt.Errorf("config %s changed since the plan was created at %s; run 'inframan plan' again", configPath, meta.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	if err := terraformExec.EnsureInit(); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %w", err)
+	}
+
+	summary, err := terraformExec.ShowPlan(planPath)
+	if err != nil {
+		return fmt.Errorf("failed to summarize plan: %w", err)
+	}
+	if !summary.HasChanges() {
+		fmt.Fprintln(progress, "No changes in plan. Infrastructure is up-to-date.")
+		return nil
+	}
+
+	if err := orchestrator.RunHooks(orchestrator.HookPreInfra, progress); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(progress, "Applying saved plan %s...\n", planPath)
+	if err := terraformExec.ApplyPlan(planPath); err != nil {
+		return fmt.Errorf("terraform apply failed: %w", err)
+	}
+	markChangesApplied()
+
+	fmt.Fprintln(progress, "Infrastructure applied successfully!")
+	refreshSSHConfig()
+	return orchestrator.RunHooks(orchestrator.HookPostInfra, progress)
+}
@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+)
+
+func TestApplyInfraNoChangesRunsPostInfra(t *testing.T) {
+	fake := setupProject(t, "prod", `{}`)
+	t.Setenv("INFRAMAN_NON_INTERACTIVE", "1")
+	changesApplied = false
+	t.Cleanup(func() { changesApplied = false })
+	if err := os.WriteFile(orchestrator.ProjectFileName, []byte(`{"projects": {"prod": {"hooks": {"post_infra": ["./notify.sh"]}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	terraformExec, err := orchestrator.NewTerraformExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake plan exits with 0: no changes
+	if err := applyInfra(io.Discard, terraformExec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Join(fake.CommandLines(), "\n")
+	if strings.Contains(lines, "terraform apply") {
+		t.Errorf("applied without changes:\n%s", lines)
+	}
+	if !strings.Contains(lines, "sh -c ./notify.sh") {
+		t.Errorf("post_infra hook not run:\n%s", lines)
+	}
+	if changesApplied {
+		t.Error("changes reported as applied")
+	}
+}
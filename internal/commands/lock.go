@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// addWaitFlag adds the --wait flag to a command that locks the project
+func addWaitFlag(cmd *cobra.Command, wait *time.Duration) {
+	cmd.Flags().DurationVar(wait, "wait", 0, "Wait up to this long for the project lock held by another run (e.g. 10m)")
+}
+
+// lockProject takes the current project's lock for the named command and
+// returns a function releasing it
+func lockProject(command string, wait time.Duration) (func(), error) {
+	lock, err := orchestrator.AcquireLock(orchestrator.GetProjectName(), command, wait)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := lock.Release(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}, nil
+}
+
+// NewUnlockCommand creates the unlock command
+func NewUnlockCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unlock [project]",
+		Short: "Remove a project lock left by an interrupted run",
+		Long: `Unlock removes the advisory lock of a project (default: the current project).
+
+infra, plan, deploy, destroy, up and rollback lock .inframan/<project>/ while
+they run so that concurrent runs cannot corrupt config.tf.json or hive.nix. Locks left
+by a process that exited on this host are removed automatically; use unlock
+for locks left on another host or by a hung run.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			projectName := orchestrator.GetProjectName()
+			if len(args) == 1 {
+				projectName = args[0]
+			}
+
+			holder, removed, err := orchestrator.ForceUnlock(projectName)
+			if err != nil {
+				return fmt.Errorf("failed to unlock project %q: %w", projectName, err)
+			}
+			if !removed {
+				fmt.Printf("Project %q is not locked.\n", projectName)
+				return nil
+			}
+			if holder == nil {
+				fmt.Printf("Removed unreadable lock on project %q\n", projectName)
+				return nil
+			}
+
+			fmt.Printf("Removed lock on project %q held by %s\n", projectName, holder)
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Output formats of the --output flag
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// structuredOutputAnnotation marks commands that can print their results as
+// json or yaml
+const structuredOutputAnnotation = "inframan/structured-output"
+
+// outputFormat is the format results are printed in
+var outputFormat = outputTable
+
+// SetOutputFormat sets the format of command results: table (the default),
+// json or yaml. Only commands annotated with structuredOutputAnnotation
+// accept json or yaml.
+func SetOutputFormat(cmd *cobra.Command, format string) error {
+	switch format {
+	case outputTable:
+	case outputJSON, outputYAML:
+		if cmd.Annotations[structuredOutputAnnotation] == "" {
+			return fmt.Errorf("%s does not support --output %s", cmd.CommandPath(), format)
+		}
+	default:
+		return fmt.Errorf("unknown output format %q (expected %s, %s or %s)", format, outputTable, outputJSON, outputYAML)
+	}
+	outputFormat = format
+	return nil
+}
+
+// withStructuredOutput marks cmd as able to print its results as json or yaml
+func withStructuredOutput(cmd *cobra.Command) *cobra.Command {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[structuredOutputAnnotation] = "true"
+	return cmd
+}
+
+// output is where a command prints. Results go to result, on stdout, and
+// progress messages, hook output and terraform and colmena output go to
+// progress, on stderr, so that stdout holds only the result.
+type output struct {
+	format   string
+	result   io.Writer
+	progress io.Writer
+}
+
+// newOutput returns the output of a command in the --output format
+func newOutput() *output {
+	return &output{format: outputFormat, result: os.Stdout, progress: os.Stderr}
+}
+
+// structured reports whether results are printed as json or yaml
+func (o *output) structured() bool {
+	return o.format == outputJSON || o.format == outputYAML
+}
+
+// tableOnly returns an error if results are printed as json or yaml, for
+// modes of a structured-output command that print no result, e.g. ssh
+// without --list
+func (o *output) tableOnly(mode string) error {
+	if o.structured() {
+		return fmt.Errorf("--output %s is not supported by %s", o.format, mode)
+	}
+	return nil
+}
+
+// printResult writes v to the result output as JSON or YAML. Field names and
+// order follow the json tags of v, so both formats hold the same data.
+func (o *output) printResult(v interface{}) error {
+	if o.format == outputYAML {
+		return writeYAML(o.result, v)
+	}
+	encoder := json.NewEncoder(o.result)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// yamlField is a key and value of a decoded JSON object, kept in order
+type yamlField struct {
+	key   string
+	value interface{}
+}
+
+// writeYAML writes v as a YAML document, converted from its JSON encoding
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	node, err := decodeJSONNode(decoder)
+	if err != nil {
+		return fmt.Errorf("failed to convert to YAML: %w", err)
+	}
+
+	var out strings.Builder
+	if isYAMLCollection(node) {
+		emitYAML(&out, node, 0)
+	} else {
+		out.WriteString(yamlScalar(node) + "\n")
+	}
+	_, err = io.WriteString(w, out.String())
+	return err
+}
+
+// decodeJSONNode decodes the next JSON value, keeping object keys in order
+// as []yamlField. Arrays decode to []interface{}, numbers to json.Number.
+func decodeJSONNode(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		fields := []yamlField{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, yamlField{key: key.(string), value: value})
+		}
+		_, err := decoder.Token()
+		return fields, err
+	case json.Delim('['):
+		items := []interface{}{}
+		for decoder.More() {
+			item, err := decodeJSONNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err := decoder.Token()
+		return items, err
+	}
+	return token, nil
+}
+
+// isYAMLCollection reports whether node is a non-empty object or array,
+// which is written as a block rather than on one line
+func isYAMLCollection(node interface{}) bool {
+	switch n := node.(type) {
+	case []yamlField:
+		return len(n) > 0
+	case []interface{}:
+		return len(n) > 0
+	}
+	return false
+}
+
+// emitYAML writes a non-empty object or array as a block indented by indent
+// spaces
+func emitYAML(out *strings.Builder, node interface{}, indent int) {
+	prefix := strings.Repeat(" ", indent)
+
+	switch n := node.(type) {
+	case []yamlField:
+		for _, field := range n {
+			out.WriteString(prefix + yamlScalar(field.key) + ":")
+			if isYAMLCollection(field.value) {
+				out.WriteString("\n")
+				emitYAML(out, field.value, indent+2)
+			} else {
+				out.WriteString(" " + yamlScalar(field.value) + "\n")
+			}
+		}
+	case []interface{}:
+		for _, item := range n {
+			if !isYAMLCollection(item) {
+				out.WriteString(prefix + "- " + yamlScalar(item) + "\n")
+				continue
+			}
+			// Write the item indented under the dash, then put the dash on
+			// its first line
+			var block strings.Builder
+			emitYAML(&block, item, indent+2)
+			out.WriteString(prefix + "- " + block.String()[indent+2:])
+		}
+	}
+}
+
+// plainYAMLString matches strings that YAML reads back as the same string
+// without quoting
+var plainYAMLString = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./+=,@-]*$`)
+
+// yamlReserved are plain words YAML reads as booleans or null
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true,
+	"off": true, "y": true, "n": true, "null": true,
+}
+
+// yamlScalar returns a scalar or empty collection as a YAML value
+func yamlScalar(node interface{}) string {
+	switch n := node.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(n)
+	case json.Number:
+		return n.String()
+	case string:
+		if plainYAMLString.MatchString(n) && !yamlReserved[strings.ToLower(n)] {
+			return n
+		}
+		return strconv.Quote(n)
+	case []yamlField:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+	return fmt.Sprint(node)
+}
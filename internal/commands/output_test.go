@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// captureResults returns an output in format that collects printed results
+// and discards progress
+func captureResults(format string) (*output, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return &output{format: format, result: &buf, progress: io.Discard}, &buf
+}
+
+func TestWriteYAML(t *testing.T) {
+	type change struct {
+		Address string   `json:"address"`
+		Actions []string `json:"actions"`
+	}
+	v := []interface{}{
+		struct {
+			Project string            `json:"project"`
+			Count   int               `json:"count"`
+			Ok      bool              `json:"ok"`
+			Error   *string           `json:"error"`
+			Changes []change          `json:"changes"`
+			Labels  map[string]string `json:"labels"`
+			Tags    []string          `json:"tags"`
+		}{
+			Project: "prod",
+			Count:   2,
+			Ok:      true,
+			Changes: []change{{Address: "aws_instance.web", Actions: []string{"delete", "create"}}},
+			Labels:  map[string]string{},
+			Tags:    []string{},
+		},
+		[]string{"yes", "10.0.0.1", "a: b", "in sync", "/nix/store/abc-system"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeYAML(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `- project: prod
+  count: 2
+  ok: true
+  error: null
+  changes:
+    - address: aws_instance.web
+      actions:
+        - delete
+        - create
+  labels: {}
+  tags: []
+- - "yes"
+  - "10.0.0.1"
+  - "a: b"
+  - "in sync"
+  - /nix/store/abc-system
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writeYAML() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSetOutputFormatRejectsUnknown(t *testing.T) {
+	if err := SetOutputFormat(NewHistoryCommand(), "xml"); err == nil {
+		t.Error("expected an error for an unknown output format")
+	}
+}
+
+func TestSetOutputFormatRequiresStructuredOutput(t *testing.T) {
+	t.Cleanup(func() { outputFormat = outputTable })
+
+	for _, cmd := range []*cobra.Command{NewInfraCommand(), NewDestroyCommand(), NewSSHConfigCommand()} {
+		if err := SetOutputFormat(cmd, outputJSON); err == nil {
+			t.Errorf("%s: expected an error for --output json", cmd.Name())
+		}
+		if err := SetOutputFormat(cmd, outputTable); err != nil {
+			t.Errorf("%s: unexpected error for --output table: %v", cmd.Name(), err)
+		}
+	}
+
+	if err := SetOutputFormat(NewExecCommand(), outputJSON); err != nil {
+		t.Errorf("exec: unexpected error for --output json: %v", err)
+	}
+	if err := SetOutputFormat(NewPlanCommand(), outputYAML); err != nil {
+		t.Errorf("plan: unexpected error for --output yaml: %v", err)
+	}
+	if !newOutput().structured() {
+		t.Error("expected structured output after --output yaml")
+	}
+}
+
+func TestOutputTableOnly(t *testing.T) {
+	table, _ := captureResults(outputTable)
+	if err := table.tableOnly("ssh without --list"); err != nil {
+		t.Errorf("unexpected error for table output: %v", err)
+	}
+	structured, _ := captureResults(outputJSON)
+	if err := structured.tableOnly("ssh without --list"); err == nil {
+		t.Error("expected an error for json output")
+	}
+}
+
+func TestListAllInstancesJSON(t *testing.T) {
+	setupProject(t, "prod", `{"instances": {"value": {"web-1": {"public_ip": "203.0.113.1", "private_ip": "10.0.0.1", "ssh_user": "nixos", "tags": ["web"]}}}}`)
+	t.Setenv("SSH_BASTION", "")
+	out, buf := captureResults(outputJSON)
+
+	if err := listAllInstances(out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var records []*instanceRecord
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("output is not a JSON list of instances: %v\n%s", err, buf.String())
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d instances, want 1", len(records))
+	}
+	want := instanceRecord{
+		Name:      "prod/web-1",
+		Project:   "prod",
+		Instance:  "web-1",
+		Address:   "203.0.113.1",
+		PublicIP:  "203.0.113.1",
+		PrivateIP: "10.0.0.1",
+		User:      "nixos",
+		Port:      22,
+	}
+	got := *records[0]
+	if len(got.Tags) != 1 || got.Tags[0] != "web" {
+		t.Errorf("tags = %v, want [web]", got.Tags)
+	}
+	got.Tags = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("instance = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// NewPlanCommand creates the plan command
+func NewPlanCommand() *cobra.Command {
+	var planFile string
+	var wait time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Plan infrastructure changes and save the plan",
+		Long: `Plan previews infrastructure changes without applying them:
+1. Copies the INFRA_CONFIG_JSON config to .inframan/<project>/terraform/config.tf.json
+2. Runs terraform init and terraform plan, saving the plan file
+3. Summarizes the resources to add, change and destroy
+
+Apply exactly the reviewed plan with:
+  inframan infra --plan-file <file>`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := newOutput()
+
+			release, err := lockProject("plan", wait)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			terraformExec, err := setupInfraWorkspace(out.progress)
+			if err != nil {
+				return err
+			}
+
+			planPath := terraformExec.GetPlanPath(planFile)
+
+			fmt.Fprintln(out.progress, "Planning infrastructure...")
+			if err := terraformExec.Plan(planPath); err != nil {
+				return fmt.Errorf("terraform plan failed: %w", err)
+			}
+
+			// Record which config the plan was created from
+			configHash, err := orchestrator.HashFile(terraformExec.GetConfigPath())
+			if err != nil {
+				return err
+			}
+			if err := orchestrator.WritePlanMeta(planPath, configHash); err != nil {
+				return err
+			}
+
+			summary, err := terraformExec.ShowPlan(planPath)
+			if err != nil {
+				return fmt.Errorf("failed to summarize plan: %w", err)
+			}
+
+			if out.structured() {
+				return out.printResult(&planResult{
+					Project:    orchestrator.GetProjectName(),
+					PlanFile:   planPath,
+					HasChanges: summary.HasChanges(),
+					Add:        summary.Add,
+					Change:     summary.Change,
+					Destroy:    summary.Destroy,
+					Changes:    resourceChangeRecords(summary.Changes),
+					Drift:      resourceChangeRecords(summary.Drift),
+				})
+			}
+
+			printPlanSummary(out.result, summary)
+			fmt.Fprintf(out.result, "Plan saved to: %s\n", planPath)
+			fmt.Fprintf(out.result, "Apply it with: inframan infra --plan-file %s\n", planFile)
+			return nil
+		},
+	}
+
+	addWaitFlag(cmd, &wait)
+	cmd.Flags().StringVarP(&planFile, "out", "o", orchestrator.PlanFileName, "Plan file name (relative to .inframan/<project>/terraform/)")
+
+	return withStructuredOutput(cmd)
+}
+
+// planResult is a saved plan as printed with --output json or yaml
+type planResult struct {
+	Project    string                  `json:"project"`
+	PlanFile   string                  `json:"plan_file"`
+	HasChanges bool                    `json:"has_changes"`
+	Add        int                     `json:"add"`
+	Change     int                     `json:"change"`
+	Destroy    int                     `json:"destroy"`
+	Changes    []*resourceChangeRecord `json:"changes"`
+	Drift      []*resourceChangeRecord `json:"drift"`
+}
+
+// resourceChangeRecord is a planned or drifted resource change as printed
+// with --output json or yaml
+type resourceChangeRecord struct {
+	Address string   `json:"address"`
+	Action  string   `json:"action"`
+	Actions []string `json:"actions"`
+}
+
+// resourceChangeRecords returns the records of changes, an empty list
+// rather than null if there are none
+func resourceChangeRecords(changes []*orchestrator.ResourceChange) []*resourceChangeRecord {
+	records := make([]*resourceChangeRecord, len(changes))
+	for i, change := range changes {
+		records[i] = &resourceChangeRecord{
+			Address: change.Address,
+			Action:  change.Action(),
+			Actions: append([]string{}, change.Actions...),
+		}
+	}
+	return records
+}
+
+// printPlanSummary displays the resource changes of a plan
+func printPlanSummary(w io.Writer, summary *orchestrator.PlanSummary) {
+	fmt.Fprintln(w)
+	if !summary.HasChanges() {
+		fmt.Fprintln(w, "No changes. Infrastructure matches the configuration.")
+		fmt.Fprintln(w)
+		return
+	}
+
+	fmt.Fprintln(w, "Resource changes:")
+	fmt.Fprintln(w)
+	for _, change := range summary.Changes {
+		fmt.Fprintf(w, "  %-8s %s\n", change.Action(), change.Address)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Plan: %d to add, %d to change, %d to destroy.\n", summary.Add, summary.Change, summary.Destroy)
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// NewRollbackCommand creates the rollback command
+func NewRollbackCommand() *cobra.Command {
+	var generation int
+	var user string
+	var identityFile string
+	var wait time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "rollback <selector>",
+		Short: "Activate an earlier NixOS generation on an instance",
+		Long: `Rollback lists the NixOS system generations on an instance, activates the
+chosen one (default: the generation before the current one, like
+'nixos-rebuild switch --rollback') and records the rollback in the project
+history.
+
+The generation is prompted for unless --generation is given or inframan runs
+non-interactively, in which case the previous generation is used.
+
+Examples:
+  # Pick a generation on a single-instance project
+  inframan rollback account1
+
+  # Roll back a specific instance to generation 41
+  inframan rollback production/web-1 --generation 41`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info, err := selectInstance(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to get instance info: %w", err)
+			}
+
+			lock, err := orchestrator.AcquireLock(info.ProjectName, "rollback", wait)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := lock.Release(); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}()
+
+			return rollbackInstance(info, orchestrator.SSHOptions{User: user, IdentityFile: identityFile}, generation)
+		},
+	}
+
+	addWaitFlag(cmd, &wait)
+	cmd.Flags().IntVarP(&generation, "generation", "g", 0, "Generation to activate (default: the previous generation)")
+	cmd.Flags().StringVarP(&user, "user", "u", "", "SSH user (default: the instance's ssh_user, SSH_USER or inframan.json, else root)")
+	cmd.Flags().StringVarP(&identityFile, "identity", "i", "", "Path to SSH identity file")
+
+	return cmd
+}
+
+// rollbackInstance activates a system generation on an instance and records
+// the result in the project history
+func rollbackInstance(info *orchestrator.InstanceInfo, opts orchestrator.SSHOptions, number int) error {
+	fmt.Printf("Listing generations on %s (%s)...\n", info.FullName(), instanceAddress(info))
+	generations, err := orchestrator.ListGenerations(info, opts)
+	if err != nil {
+		return err
+	}
+
+	target, err := chooseGeneration(generations, number)
+	if err != nil {
+		return fmt.Errorf("%s: %w", info.FullName(), err)
+	}
+
+	fmt.Printf("Activating generation %d (%s) on %s...\n", target.Number, target.Created, info.FullName())
+	err = orchestrator.SwitchGeneration(info, opts, target.Number)
+
+	entry := &orchestrator.HistoryEntry{
+		Command:    "rollback",
+		Instances:  []string{info.FullName()},
+		Generation: target.Number,
+	}
+	recordHistory(info.ProjectName, entry, err)
+	if err != nil {
+		return err
+	}
+
+	markChangesApplied()
+	fmt.Printf("Rolled back %s to generation %d.\n", info.FullName(), target.Number)
+	return nil
+}
+
+// chooseGeneration returns the requested generation. Without one, the
+// generations are listed and the user is prompted, defaulting to the
+// previous generation.
+func chooseGeneration(generations []*orchestrator.Generation, number int) (*orchestrator.Generation, error) {
+	if number != 0 {
+		for _, gen := range generations {
+			if gen.Number == number {
+				if gen.Current {
+					return nil, fmt.Errorf("generation %d is already current", number)
+				}
+				return gen, nil
+			}
+		}
+		return nil, fmt.Errorf("generation %d not found", number)
+	}
+
+	previous := orchestrator.PreviousGeneration(generations)
+	if previous == nil {
+		return nil, fmt.Errorf("no generation before the current one to roll back to")
+	}
+	if orchestrator.IsNonInteractive() {
+		return previous, nil
+	}
+
+	fmt.Println()
+	for _, gen := range generations {
+		marker := ""
+		if gen.Current {
+			marker = "(current)"
+		}
+		fmt.Printf("  %5d   %s   %s\n", gen.Number, gen.Created, marker)
+	}
+	fmt.Println()
+	fmt.Printf("Generation to activate [%d]: ", previous.Number)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		if err != nil {
+			return nil, fmt.Errorf("no generation selected")
+		}
+		return previous, nil
+	}
+
+	selected, err := strconv.Atoi(answer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generation %q", answer)
+	}
+	return chooseGeneration(generations, selected)
+}
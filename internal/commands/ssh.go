@@ -2,10 +2,10 @@ package commands
 
 import (
 	"fmt"
+	"net"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
-	"syscall"
 
 	"github.com/iivel-inc/inframan/internal/orchestrator"
 	"github.com/spf13/cobra"
@@ -18,12 +18,13 @@ func NewSSHCommand() *cobra.Command {
 	var listInstances bool
 
 	cmd := &cobra.Command{
-		Use:   "ssh [project[/instance]]",
+		Use:   "ssh [selector]",
 		Short: "SSH to an instance by project name",
 		Long: `SSH connects to a provisioned instance using its project and instance name.
 
 For single-instance projects, use just the project name.
-For multi-instance projects, use project/instance-name syntax.
+For multi-instance projects, use project/instance-name syntax. Any selector
+matching exactly one instance works, e.g. a glob (prod/db-*) or a tag (@db).
 
 Examples:
   # List all available instances
@@ -43,110 +44,167 @@ Examples:
   inframan ssh account1 --identity ~/.ssh/id_ed25519`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			out := newOutput()
+
 			// Handle --list flag
 			if listInstances {
-				return listAllInstances()
+				return listAllInstances(out)
 			}
 
 			// If no arguments, show available instances and prompt
 			if len(args) == 0 {
-				return listAllInstances()
+				return listAllInstances(out)
 			}
 
+			if err := out.tableOnly("ssh without --list"); err != nil {
+				return err
+			}
 			target := args[0]
 			return connectToInstance(target, user, identityFile)
 		},
 	}
 
-	cmd.Flags().StringVarP(&user, "user", "u", "root", "SSH user")
+	cmd.Flags().StringVarP(&user, "user", "u", "", "SSH user (default: the instance's ssh_user, SSH_USER or inframan.json, else root)")
 	cmd.Flags().StringVarP(&identityFile, "identity", "i", "", "Path to SSH identity file")
 	cmd.Flags().BoolVarP(&listInstances, "list", "l", false, "List all available instances")
 
-	return cmd
+	return withStructuredOutput(cmd)
 }
 
 // listAllInstances displays all available instances
-func listAllInstances() error {
+func listAllInstances(out *output) error {
 	instances, err := orchestrator.GetAllInstances()
 	if err != nil {
 		return fmt.Errorf("failed to get instances: %w", err)
 	}
 
+	if out.structured() {
+		records := make([]*instanceRecord, len(instances))
+		for i, inst := range instances {
+			records[i] = newInstanceRecord(inst)
+		}
+		return out.printResult(records)
+	}
+
 	if len(instances) == 0 {
-		fmt.Println("No instances found.")
-		fmt.Println("Run 'inframan infra' to provision infrastructure first.")
+		fmt.Fprintln(out.result, "No instances found.")
+		fmt.Fprintln(out.result, "Run 'inframan infra' to provision infrastructure first.")
 		return nil
 	}
 
-	fmt.Println("Available instances:")
-	fmt.Println()
+	fmt.Fprintln(out.result, "Available instances:")
+	fmt.Fprintln(out.result)
+	fmt.Fprintf(out.result, "  %-30s %-21s %-10s %-14s %s\n", "INSTANCE", "ADDRESS", "USER", "REGION", "TAGS")
 	for _, inst := range instances {
-		fmt.Printf("  %-30s %s\n", inst.FullName(), inst.PublicIP)
+		fmt.Fprintf(out.result, "  %-30s %-21s %-10s %-14s %s\n", inst.FullName(), instanceAddress(inst),
+			orchestrator.SSHUserFor(inst), valueOrDash(inst.Region), valueOrDash(strings.Join(inst.Tags, ",")))
 	}
-	fmt.Println()
-	fmt.Println("Connect with: inframan ssh <project[/instance]>")
+	fmt.Fprintln(out.result)
+	fmt.Fprintln(out.result, "Connect with: inframan ssh <project[/instance]>")
 
 	return nil
 }
 
-// parseTarget parses a target string into project and instance name
-// Examples: "account1" -> ("account1", ""), "production/web-1" -> ("production", "web-1")
-func parseTarget(target string) (projectName, instanceName string) {
-	parts := strings.SplitN(target, "/", 2)
-	projectName = parts[0]
-	if len(parts) > 1 {
-		instanceName = parts[1]
+// instanceRecord is an instance as listed with --output json or yaml
+type instanceRecord struct {
+	Name      string   `json:"name"`
+	Project   string   `json:"project"`
+	Instance  string   `json:"instance"`
+	Address   string   `json:"address"`
+	PublicIP  string   `json:"public_ip"`
+	PrivateIP string   `json:"private_ip"`
+	User      string   `json:"user"`
+	Port      int      `json:"port"`
+	Region    string   `json:"region"`
+	Jump      string   `json:"jump"` // Resolved bastion, user@host[:port]
+	Tags      []string `json:"tags"`
+}
+
+// newInstanceRecord returns the listing of an instance. A bastion that
+// cannot be resolved is left out with a warning, as in ssh-config.
+func newInstanceRecord(inst *orchestrator.InstanceInfo) *instanceRecord {
+	jump, err := orchestrator.ResolveJump(inst)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", inst.FullName(), err)
 	}
-	return
+	return &instanceRecord{
+		Name:      inst.FullName(),
+		Project:   inst.ProjectName,
+		Instance:  inst.InstanceName,
+		Address:   inst.Address(),
+		PublicIP:  inst.PublicIP,
+		PrivateIP: inst.PrivateIP,
+		User:      orchestrator.SSHUserFor(inst),
+		Port:      inst.Port(),
+		Region:    inst.Region,
+		Jump:      jump,
+		Tags:      append([]string{}, inst.Tags...),
+	}
+}
+
+// instanceAddress returns the address and, if not the default, SSH port of
+// an instance, e.g. "10.0.0.1" or "10.0.0.1:2222"
+func instanceAddress(inst *orchestrator.InstanceInfo) string {
+	if inst.SSHPort != 0 {
+		return net.JoinHostPort(inst.Address(), strconv.Itoa(inst.SSHPort))
+	}
+	return inst.Address()
+}
+
+// valueOrDash returns s, or "-" for an empty table cell
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// selectInstance returns the single instance matching a selector
+// Examples: "account1", "production/web-1", "production/db-*", "@bastion"
+func selectInstance(selector string) (*orchestrator.InstanceInfo, error) {
+	instances, err := orchestrator.SelectInstances(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) > 1 {
+		return nil, fmt.Errorf("%q matches %d instances, specify one: %s", selector, len(instances), strings.Join(instanceNames(instances), ", "))
+	}
+	return instances[0], nil
 }
 
 // connectToInstance establishes an SSH connection to the specified instance
 func connectToInstance(target, user, identityFile string) error {
-	// Parse target into project and instance name
-	projectName, instanceName := parseTarget(target)
-
 	// Get instance info
-	info, err := orchestrator.GetInstance(projectName, instanceName)
+	info, err := selectInstance(target)
 	if err != nil {
 		return fmt.Errorf("failed to get instance info: %w", err)
 	}
 
-	fmt.Printf("Connecting to %s (%s) as %s...\n", info.FullName(), info.PublicIP, user)
+	if user == "" {
+		user = orchestrator.SSHUserFor(info)
+	}
+
+	jump, err := orchestrator.ResolveJump(info)
+	if err != nil {
+		return err
+	}
+	if jump != "" {
+		fmt.Printf("Connecting to %s (%s via %s) as %s...\n", info.FullName(), orchestrator.TargetAddress(info, jump), jump, user)
+	} else {
+		fmt.Printf("Connecting to %s (%s) as %s...\n", info.FullName(), instanceAddress(info), user)
+	}
 
 	// Build SSH command arguments
-	sshArgs := []string{"ssh"}
-
-	// Add SSH config file if SSH_CONFIG_PATH is set (takes precedence)
-	if sshConfigPath := orchestrator.GetSSHConfigPath(); sshConfigPath != "" {
-		sshArgs = append(sshArgs, "-F", sshConfigPath)
-	} else if identityFile != "" {
-		// Add identity file if specified via flag
-		sshArgs = append(sshArgs, "-i", identityFile)
-	} else if sshKeyPath := orchestrator.GetSSHKeyPath(); sshKeyPath != "" {
-		// Fall back to SSH_KEY_PATH env var
-		sshArgs = append(sshArgs, "-i", sshKeyPath)
-	}
-
-	// Add common SSH options for convenience (only if not using custom config)
-	if orchestrator.GetSSHConfigPath() == "" {
-		sshArgs = append(sshArgs,
-			"-o", "StrictHostKeyChecking=accept-new",
-			"-o", "UserKnownHostsFile=/dev/null",
-			"-o", "LogLevel=ERROR",
-		)
-	}
-
-	// Add target
-	sshTarget := fmt.Sprintf("%s@%s", user, info.PublicIP)
-	sshArgs = append(sshArgs, sshTarget)
-
-	// Find ssh binary
-	sshPath, err := exec.LookPath("ssh")
+	sshArgs, err := orchestrator.SSHArgs(info, orchestrator.SSHOptions{User: user, IdentityFile: identityFile})
 	if err != nil {
-		return fmt.Errorf("ssh not found in PATH: %w", err)
+		return err
 	}
 
 	// Replace the current process with ssh (exec)
 	// This gives full terminal control to ssh
-	return syscall.Exec(sshPath, sshArgs, os.Environ())
+	return orchestrator.DefaultRunner.Exec(&orchestrator.Command{
+		Name: "ssh",
+		Args: sshArgs,
+		Env:  os.Environ(),
+	})
 }
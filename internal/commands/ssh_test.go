@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+// setupProject creates an initialized project in a temporary workspace and
+// installs a fake runner answering terraform output with the given JSON
+func setupProject(t *testing.T, project, output string) *orchestratortest.FakeRunner {
+	t.Helper()
+
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	t.Setenv("PROJECT_NAME", project)
+	t.Setenv("INFRAMAN_ROOT", dir)
+	t.Setenv("INFRAMAN_ENGINE", orchestrator.EngineTerraform)
+	t.Setenv("SSH_CONFIG_PATH", "")
+	t.Setenv("SSH_KEY_PATH", "")
+
+	terraformDir, err := orchestrator.GetTerraformDirForProject(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(terraformDir, ".terraform"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := orchestratortest.NewFakeRunner()
+	fake.On("terraform output -json", orchestratortest.FakeResponse{Stdout: output})
+	previous := orchestrator.DefaultRunner
+	orchestrator.DefaultRunner = fake
+	t.Cleanup(func() { orchestrator.DefaultRunner = previous })
+
+	return fake
+}
+
+func TestSelectInstance(t *testing.T) {
+	setupProject(t, "prod", `{"instances": {"value": {"web-1": "10.0.0.1", "web-2": "10.0.0.2", "db-1": "10.0.0.3"}}}`)
+
+	inst, err := selectInstance("prod/db-*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inst.FullName() != "prod/db-1" {
+		t.Errorf("selectInstance() = %s, want prod/db-1", inst.FullName())
+	}
+
+	_, err = selectInstance("prod/web-*")
+	if err == nil || !strings.Contains(err.Error(), "matches 2 instances, specify one: prod/web-1, prod/web-2") {
+		t.Errorf("error = %v, want ambiguous selector", err)
+	}
+
+	_, err = selectInstance("prod/web-3")
+	if err == nil || !strings.Contains(err.Error(), "did you mean prod/web-1, prod/web-2?") {
+		t.Errorf("error = %v, want near matches", err)
+	}
+}
+
+func TestConnectToInstance(t *testing.T) {
+	fake := setupProject(t, "prod", `{"instances": {"value": {"web-1": "10.0.0.1", "db-1": "10.0.0.2"}}}`)
+
+	if err := connectToInstance("prod/db-1", "root", "/keys/id"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls := fake.Calls()
+	last := calls[len(calls)-1]
+	if last.Name != "ssh" {
+		t.Fatalf("last command = %q, want ssh", last.String())
+	}
+	got := strings.Join(last.Args, " ")
+	for _, want := range []string{"-i /keys/id", "-o StrictHostKeyChecking=accept-new", "-o HostKeyAlias=prod/db-1", "root@10.0.0.2"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ssh args %q missing %q", got, want)
+		}
+	}
+}
+
+// remoteCommandLine returns the ssh command line, up to the remote command,
+// that runs commands on an instance of prod with the default SSH settings
+func remoteCommandLine(t *testing.T, instance, ip string) string {
+	t.Helper()
+
+	knownHosts, err := orchestrator.GetKnownHostsPath("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("ssh -o BatchMode=yes -o ConnectTimeout=10 -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=%s -o HostKeyAlias=prod/%s -o LogLevel=ERROR root@%s",
+		knownHosts, instance, ip)
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// NewSSHConfigCommand creates the ssh-config command
+func NewSSHConfigCommand() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "ssh-config",
+		Short: "Write an SSH config for every instance",
+		Long: `Ssh-config writes an OpenSSH config with a Host block for every instance of
+every project, so that plain ssh, scp and editor remote plugins work without
+inframan. Hosts are named project-instance (e.g. production-web-1) and use
+the same address, user, port, identity (SSH_KEY_PATH), bastion and pinned
+host keys as inframan ssh.
+
+The file is written to .inframan/ssh_config by default. Once it exists,
+infra, up and destroy regenerate it after changing infrastructure.
+
+Examples:
+  # Generate the config and include it from ~/.ssh/config
+  inframan ssh-config
+  echo "Include $PWD/.inframan/ssh_config" >> ~/.ssh/config
+  ssh production-web-1
+
+  # Print the config instead
+  inframan ssh-config --file -`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "-" {
+				instances, err := orchestrator.GetAllInstances()
+				if err != nil {
+					return fmt.Errorf("failed to get instances: %w", err)
+				}
+				config, _ := orchestrator.GenerateSSHConfig(instances)
+				fmt.Print(config)
+				return nil
+			}
+
+			path := file
+			if path == "" {
+				defaultPath, err := orchestrator.GetSSHConfigFilePath()
+				if err != nil {
+					return err
+				}
+				path = defaultPath
+			}
+
+			count, err := orchestrator.WriteSSHConfig(path)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Wrote %d host(s) to %s\n", count, path)
+			fmt.Printf("Add 'Include %s' to ~/.ssh/config to use them.\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Write to this file instead of .inframan/ssh_config (- for stdout)")
+
+	return cmd
+}
+
+// refreshSSHConfig regenerates the SSH config after infrastructure changed.
+// Failures only warn, as the infrastructure change itself succeeded.
+func refreshSSHConfig() {
+	if err := orchestrator.RefreshSSHConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update SSH config: %v\n", err)
+	}
+}
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// NewTunnelCommand creates the tunnel command
+func NewTunnelCommand() *cobra.Command {
+	var forwards []string
+	var opts orchestrator.TunnelOptions
+
+	cmd := &cobra.Command{
+		Use:   "tunnel <selector>",
+		Short: "Forward local ports to an instance",
+		Long: `Tunnel forwards local ports to addresses reached from an instance, or opens
+a SOCKS proxy through it, until interrupted with Ctrl-C. It connects like
+inframan ssh, including bastions and host key checking, and the selector
+must match exactly one instance.
+
+Each -L takes [bind:]local:[host:]remote; without a host, the port is
+forwarded to localhost on the instance. Repeat -L to open several tunnels
+over one connection. Unless --reconnect=false, tunnels are reopened when
+the connection drops.
+
+Examples:
+  # Reach Postgres on the instance at localhost:15432
+  inframan tunnel production/db-1 -L 15432:5432
+
+  # Several tunnels, one to a host only reachable from the instance
+  inframan tunnel production/web-1 -L 8080:80 -L 9000:admin.internal:9000
+
+  # SOCKS proxy on localhost:1080
+  inframan tunnel production/web-1 --socks 1080`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, spec := range forwards {
+				f, err := orchestrator.ParseForward(spec)
+				if err != nil {
+					return err
+				}
+				opts.Forwards = append(opts.Forwards, f)
+			}
+			if len(opts.Forwards) == 0 && opts.SOCKSPort == 0 {
+				return fmt.Errorf("specify at least one -L forward or --socks")
+			}
+			if opts.SOCKSPort < 0 || opts.SOCKSPort > 65535 {
+				return fmt.Errorf("invalid --socks port %d", opts.SOCKSPort)
+			}
+
+			return openTunnels(args[0], opts)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&forwards, "local", "L", nil, "Forward a local port: [bind:]local:[host:]remote (repeatable)")
+	cmd.Flags().IntVar(&opts.SOCKSPort, "socks", 0, "Open a SOCKS proxy on this local port")
+	cmd.Flags().BoolVar(&opts.Reconnect, "reconnect", true, "Reopen the tunnels when the connection drops")
+	cmd.Flags().StringVarP(&opts.SSH.User, "user", "u", "", "SSH user (default: the instance's ssh_user, SSH_USER or inframan.json, else root)")
+	cmd.Flags().StringVarP(&opts.SSH.IdentityFile, "identity", "i", "", "Path to SSH identity file")
+
+	return cmd
+}
+
+// openTunnels opens the tunnels of opts to the instance matching selector
+func openTunnels(selector string, opts orchestrator.TunnelOptions) error {
+	info, err := selectInstance(selector)
+	if err != nil {
+		return fmt.Errorf("failed to get instance info: %w", err)
+	}
+
+	fmt.Printf("Opening tunnels to %s:\n", info.FullName())
+	for _, f := range opts.Forwards {
+		fmt.Printf("  %-30s -> %s\n", f.Local(), f.Remote())
+	}
+	if opts.SOCKSPort != 0 {
+		fmt.Printf("  %-30s -> SOCKS proxy\n", fmt.Sprintf("localhost:%d", opts.SOCKSPort))
+	}
+	fmt.Println("Press Ctrl-C to close.")
+
+	return orchestrator.Tunnel(info, opts)
+}
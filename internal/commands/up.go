@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator"
+	"github.com/spf13/cobra"
+)
+
+// NewUpCommand creates the up command
+func NewUpCommand() *cobra.Command {
+	var sshTimeout time.Duration
+	var sshPort int
+	var wait time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Provision infrastructure, wait for SSH, then deploy",
+		Long: `Up runs the whole workflow in one command:
+1. Copies the INFRA_CONFIG_JSON config and runs terraform init and apply
+2. Waits until every instance of the project accepts SSH connections,
+   retrying with backoff until --ssh-timeout elapses
+3. Generates the Colmena hive and runs colmena apply
+4. Runs the project's health_checks from inframan.json on every instance
+
+This avoids the first deploy failing because a freshly created host is not
+accepting SSH connections yet.`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			out := newOutput()
+
+			release, err := lockProject("up", wait)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			entry := &orchestrator.HistoryEntry{Command: "up", ModulePath: orchestrator.GetNixOSModulePath()}
+			defer func() { recordHistory(orchestrator.GetProjectName(), entry, err) }()
+
+			// Resolve machine modules first so a bad module path fails before provisioning
+			modules, err := loadMachineModules()
+			if err != nil {
+				return err
+			}
+
+			terraformExec, err := setupInfraWorkspace(out.progress)
+			if err != nil {
+				return err
+			}
+
+			if err := applyInfra(out.progress, terraformExec); err != nil {
+				return err
+			}
+
+			projectName := orchestrator.GetProjectName()
+			instances, err := orchestrator.GetInstancesForProject(projectName)
+			if err != nil {
+				return fmt.Errorf("failed to get instances: %w", err)
+			}
+			entry.Instances = instanceNames(instances)
+
+			fmt.Fprintf(out.progress, "Waiting for SSH on %d instance(s) (timeout %s)...\n", len(instances), sshTimeout)
+			if err := orchestrator.WaitForSSH(instances, sshPort, sshTimeout, out.progress); err != nil {
+				return err
+			}
+
+			return deployInstances(out, modules, instances, rolloutOptions{healthTimeout: orchestrator.DefaultHealthTimeout})
+		},
+	}
+
+	addWaitFlag(cmd, &wait)
+	cmd.Flags().DurationVar(&sshTimeout, "ssh-timeout", 5*time.Minute, "How long to wait for instances to accept SSH")
+	cmd.Flags().IntVar(&sshPort, "ssh-port", orchestrator.DefaultSSHPort, "SSH port to wait for")
+
+	return cmd
+}
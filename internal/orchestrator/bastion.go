@@ -0,0 +1,180 @@
+package orchestrator
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GetSSHBastion returns the jump host of a project's instances from
+// SSH_BASTION or inframan.json, or empty string if not set
+func GetSSHBastion(projectName string) string {
+	return projectSSHConfig(projectName).Bastion
+}
+
+// isBastionSelector reports whether a bastion refers to an inframan
+// instance (e.g. "network/bastion" or "@bastion") rather than a host
+func isBastionSelector(bastion string) bool {
+	return strings.Contains(bastion, "/") || strings.HasPrefix(bastion, "@")
+}
+
+// bastionInstances caches bastion instances by workspace root and selector,
+// so that reaching many instances reads the bastion's project only once
+var (
+	bastionMu        sync.Mutex
+	bastionInstances = make(map[string]*InstanceInfo)
+)
+
+// bastionInstance returns the single instance a bastion selector matches
+func bastionInstance(selector string) (*InstanceInfo, error) {
+	root, _ := GetWorkspaceRoot()
+	key := root + "\x00" + selector
+
+	bastionMu.Lock()
+	defer bastionMu.Unlock()
+	if inst, ok := bastionInstances[key]; ok {
+		return inst, nil
+	}
+
+	instances, err := SelectInstances(selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve bastion %q: %w", selector, err)
+	}
+	if len(instances) > 1 {
+		return nil, fmt.Errorf("bastion %q matches %d instances", selector, len(instances))
+	}
+
+	bastionInstances[key] = instances[0]
+	return instances[0], nil
+}
+
+// ResolveJump returns the jump host ([user@]host[:port], as accepted by
+// ProxyJump) through which an instance is reached, or empty string to
+// connect directly. The instance's bastion output takes precedence over
+// SSH_BASTION and inframan.json. A bastion that is an inframan instance is
+// reached on its own address, user and port.
+func ResolveJump(inst *InstanceInfo) (string, error) {
+	jump, _, err := resolveBastion(inst)
+	return jump, err
+}
+
+// resolveBastion returns the jump host of an instance as ResolveJump does,
+// and the bastion instance if the bastion is managed by inframan
+func resolveBastion(inst *InstanceInfo) (string, *InstanceInfo, error) {
+	bastion := firstNonEmpty(inst.Bastion, GetSSHBastion(inst.ProjectName))
+	if bastion == "" || !isBastionSelector(bastion) {
+		return bastion, nil, nil
+	}
+
+	jumpInst, err := bastionInstance(bastion)
+	if err != nil {
+		return "", nil, err
+	}
+	// The bastion itself is reached directly
+	if jumpInst.FullName() == inst.FullName() {
+		return "", nil, nil
+	}
+
+	host := jumpInst.Address()
+	if jumpInst.SSHPort != 0 {
+		host = net.JoinHostPort(host, strconv.Itoa(jumpInst.SSHPort))
+	}
+	return SSHUserFor(jumpInst) + "@" + host, jumpInst, nil
+}
+
+// jumpOptions returns the ssh options reaching an instance through its jump
+// host, or nil to connect directly.
+//
+// ssh does not pass -o options such as UserKnownHostsFile on to a ProxyJump
+// connection, so the jump host is reached with a ProxyCommand verifying its
+// key as well: a bastion instance against its own project's known_hosts and
+// host_key, other hosts pinned on first use in the instance's project's
+// known_hosts. With SSH_CONFIG_PATH, host keys are left to that config and
+// ProxyJump is used.
+func jumpOptions(inst *InstanceInfo) ([]sshOption, error) {
+	jump, jumpInst, err := resolveBastion(inst)
+	if err != nil || jump == "" {
+		return nil, err
+	}
+	if projectSSHConfig(inst.ProjectName).ConfigPath != "" {
+		return []sshOption{{Key: "ProxyJump", Value: jump}}, nil
+	}
+
+	// The jump host is reached with its own project's key
+	keyProject := inst.ProjectName
+	var hostKeyOpts []sshOption
+	if jumpInst != nil {
+		keyProject = jumpInst.ProjectName
+		if hostKeyOpts, err = hostKeyOptions(jumpInst); err != nil {
+			return nil, err
+		}
+	} else {
+		knownHosts, err := GetKnownHostsPath(inst.ProjectName)
+		if err != nil {
+			return nil, err
+		}
+		if err := EnsureDir(filepath.Dir(knownHosts)); err != nil {
+			return nil, err
+		}
+		hostKeyOpts = []sshOption{
+			{Key: "StrictHostKeyChecking", Value: "accept-new"},
+			{Key: "UserKnownHostsFile", Value: knownHosts},
+		}
+	}
+
+	args := []string{"ssh"}
+	if keyPath := projectSSHConfig(keyProject).KeyPath; keyPath != "" {
+		args = append(args, "-i", keyPath)
+	}
+	args = append(args, optionArgs(hostKeyOpts)...)
+	if IsNonInteractive() {
+		args = append(args, "-o", "BatchMode=yes")
+	}
+	userHost, port := splitJump(jump)
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, userHost)
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = proxyCommandArg(arg)
+	}
+	// %h and %p are expanded by ssh to the target's address and port
+	command := strings.Join(quoted, " ") + " -W %h:%p"
+	return []sshOption{{Key: "ProxyCommand", Value: command}}, nil
+}
+
+// splitJump splits a jump host [user@]host[:port] into [user@]host and port
+func splitJump(jump string) (userHost, port string) {
+	user, hostPort := "", jump
+	if i := strings.LastIndex(jump, "@"); i >= 0 {
+		user, hostPort = jump[:i+1], jump[i+1:]
+	}
+	if host, port, err := net.SplitHostPort(hostPort); err == nil {
+		return user + host, port
+	}
+	return jump, ""
+}
+
+// proxyCommandArg quotes an argument of a ProxyCommand, which ssh runs with
+// sh after expanding % tokens
+func proxyCommandArg(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if safeShellArg.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// TargetAddress returns the address to connect to: the private IP when
+// going through a jump host, the public IP otherwise
+func TargetAddress(inst *InstanceInfo, jump string) string {
+	if jump != "" && inst.PrivateIP != "" {
+		return inst.PrivateIP
+	}
+	return inst.Address()
+}
@@ -0,0 +1,133 @@
+package orchestrator
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestResolveJump(t *testing.T) {
+	fake := setupWorkspace(t)
+	t.Setenv("SSH_KEY_PATH", "")
+	t.Setenv("SSH_CONFIG_PATH", "")
+	createProject(t, "prod")
+	fake.On("terraform output -json", orchestratortest.FakeResponse{Stdout: `{"instances": {"value": {
+		"bastion": {"public_ip": "1.2.3.4", "private_ip": "10.1.0.1", "ssh_user": "ubuntu"},
+		"db-1": {"private_ip": "10.1.0.5"},
+		"web-1": {"public_ip": "5.6.7.8", "private_ip": "10.1.0.6", "bastion": "admin@jump.example.com:2222"}
+	}}}`})
+	instances, err := GetInstancesForProject("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bastion, db, web := instances[0], instances[1], instances[2]
+
+	// No bastion configured
+	for _, inst := range instances[:2] {
+		if jump, err := ResolveJump(inst); err != nil || jump != "" {
+			t.Errorf("ResolveJump(%s) = %q, %v, want direct", inst.FullName(), jump, err)
+		}
+	}
+
+	t.Setenv("SSH_BASTION", "prod/bastion")
+	tests := []struct {
+		inst    *InstanceInfo
+		want    string
+		address string
+	}{
+		{inst: bastion, want: "", address: "1.2.3.4"},
+		{inst: db, want: "ubuntu@1.2.3.4", address: "10.1.0.5"},
+		{inst: web, want: "admin@jump.example.com:2222", address: "10.1.0.6"},
+	}
+	for _, tt := range tests {
+		jump, err := ResolveJump(tt.inst)
+		if err != nil {
+			t.Fatalf("ResolveJump(%s) error = %v", tt.inst.FullName(), err)
+		}
+		if jump != tt.want {
+			t.Errorf("ResolveJump(%s) = %q, want %q", tt.inst.FullName(), jump, tt.want)
+		}
+		if got := TargetAddress(tt.inst, jump); got != tt.address {
+			t.Errorf("TargetAddress(%s) = %q, want %q", tt.inst.FullName(), got, tt.address)
+		}
+	}
+
+	// The jump host's key is verified like the instance's: a bastion
+	// instance against its own pinned key, other hosts pinned on first use
+	knownHosts, err := GetKnownHostsPath("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bastionProxy := "ProxyCommand=ssh -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=" + knownHosts +
+		" -o HostKeyAlias=prod/bastion ubuntu@1.2.3.4 -W %h:%p"
+	hostProxy := "ProxyCommand=ssh -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=" + knownHosts +
+		" -p 2222 admin@jump.example.com -W %h:%p"
+
+	args, err := SSHArgs(db, SSHOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, " "); !strings.HasSuffix(got, " -o "+bastionProxy+" root@10.1.0.5") {
+		t.Errorf("SSHArgs() = %q", got)
+	}
+	args, err = SSHArgs(web, SSHOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, " "); !strings.HasSuffix(got, " -o "+hostProxy+" root@10.1.0.6") {
+		t.Errorf("SSHArgs() with host bastion = %q", got)
+	}
+
+	// With SSH_CONFIG_PATH, host keys are left to the config
+	t.Setenv("SSH_CONFIG_PATH", "/ssh/config")
+	args, err = SSHArgs(db, SSHOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, " "); got != "-F /ssh/config -o ProxyJump=ubuntu@1.2.3.4 root@10.1.0.5" {
+		t.Errorf("SSHArgs() with config = %q", got)
+	}
+	t.Setenv("SSH_CONFIG_PATH", "")
+
+	colmenaExec, err := NewColmenaExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hivePath, err := colmenaExec.GenerateHive(&MachineModules{Default: "/m.nix"}, instances)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(hivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`deployment.targetHost = "10.1.0.5";`,
+		`"-o" "HostKeyAlias=prod/db-1" "-o" "` + bastionProxy + `" ];`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("hive missing %q:\n%s", want, data)
+		}
+	}
+
+	t.Setenv("SSH_BASTION", "prod/missing")
+	if _, err := ResolveJump(db); err == nil || !strings.Contains(err.Error(), `failed to resolve bastion "prod/missing"`) {
+		t.Errorf("ResolveJump() with missing bastion error = %v", err)
+	}
+}
+
+func TestProxyCommandArg(t *testing.T) {
+	tests := map[string]string{
+		"/keys/id_ed25519": "/keys/id_ed25519",
+		"/keys/my key":     "'/keys/my key'",
+		"/keys/it's":       `'/keys/it'\''s'`,
+		"/keys/100%":       "/keys/100%%",
+	}
+	for arg, want := range tests {
+		if got := proxyCommandArg(arg); got != want {
+			t.Errorf("proxyCommandArg(%q) = %q, want %q", arg, got, want)
+		}
+	}
+}
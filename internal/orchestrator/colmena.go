@@ -1,9 +1,11 @@
 package orchestrator
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -11,6 +13,8 @@ import (
 // ColmenaExecutor handles colmena command execution
 type ColmenaExecutor struct {
 	workDir string
+	runner  Runner
+	stdout  io.Writer
 }
 
 // NewColmenaExecutor creates a new colmena executor
@@ -25,55 +29,125 @@ func NewColmenaExecutor() (*ColmenaExecutor, error) {
 		return nil, err
 	}
 
-	return &ColmenaExecutor{workDir: workDir}, nil
+	return &ColmenaExecutor{workDir: workDir, runner: DefaultRunner, stdout: os.Stdout}, nil
 }
 
-// hiveTemplate is the template for generating a dynamic hive.nix
-const hiveTemplate = `{
+// SetRunner replaces the runner used to execute colmena commands
+func (c *ColmenaExecutor) SetRunner(runner Runner) {
+	c.runner = runner
+}
+
+// SetOutput sets where colmena output is written (default: stdout)
+func (c *ColmenaExecutor) SetOutput(w io.Writer) {
+	c.stdout = w
+}
+
+// hiveHeader is the template for the meta section of a dynamic hive.nix
+const hiveHeader = `{
   meta = {
     nixpkgs = import <nixpkgs> { system = "x86_64-linux"; };
   };
+`
 
-  # Define the node
-  target-node = { ... }: {
-    imports = [ (import %s) ]; # Import the user's module
+// nodeTemplate is the template for a single node in a dynamic hive.nix
+const nodeTemplate = `
+  # Node for instance %s
+  %q = { ... }: {
+    imports = [ %s ]; # Import the user's modules
     deployment.targetHost = "%s"; # Injected IP
-    deployment.targetUser = "root";
+    deployment.targetUser = "%s";
+    deployment.targetPort = %d;%s
     deployment.buildOnTarget = true; # Build on remote instance, not locally
   };
-}
 `
 
-// GenerateHive creates an ephemeral hive.nix with the target IP injected
-func (c *ColmenaExecutor) GenerateHive(modulePath, targetIP string) (string, error) {
+// GenerateHive creates an ephemeral hive.nix with one node per instance,
+// each importing its machine modules and with its target IP and, for
+// instances behind a bastion, ProxyJump option injected
+func (c *ColmenaExecutor) GenerateHive(modules *MachineModules, instances []*InstanceInfo) (string, error) {
+	if len(instances) == 0 {
+		return "", fmt.Errorf("no instances to deploy")
+	}
+
 	// Ensure workdir exists
 	if err := os.MkdirAll(c.workDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create workdir: %w", err)
 	}
 
-	// Convert module path to absolute path for Nix
-	absModulePath, err := filepath.Abs(modulePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path: %w", err)
-	}
-
 	// Generate the hive content
-	// Escape the path for Nix (wrap in quotes)
-	nixPath := fmt.Sprintf("\"%s\"", absModulePath)
-	hiveContent := fmt.Sprintf(hiveTemplate, nixPath, targetIP)
+	var hive strings.Builder
+	hive.WriteString(hiveHeader)
+	for _, inst := range instances {
+		modulePaths, err := modules.ModulesFor(inst)
+		if err != nil {
+			return "", err
+		}
+
+		// Escape the paths for Nix (wrap in quotes)
+		imports := make([]string, len(modulePaths))
+		for i, modulePath := range modulePaths {
+			imports[i] = fmt.Sprintf("(import \"%s\")", modulePath)
+		}
+
+		// Instances behind a bastion are reached on their private IP
+		jump, err := ResolveJump(inst)
+		if err != nil {
+			return "", err
+		}
+		sshOptions, err := nodeSSHOptions(inst)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&hive, nodeTemplate, inst.FullName(), inst.NodeName(), strings.Join(imports, " "),
+			TargetAddress(inst, jump), SSHUserFor(inst), inst.Port(), sshOptions)
+	}
+	hive.WriteString("}\n")
 
 	// Write to hive.nix
 	hivePath := filepath.Join(c.workDir, HiveFileName)
-	if err := os.WriteFile(hivePath, []byte(hiveContent), 0644); err != nil {
+	if err := os.WriteFile(hivePath, []byte(hive.String()), 0644); err != nil {
 		return "", fmt.Errorf("failed to write hive.nix: %w", err)
 	}
 
 	return hivePath, nil
 }
 
-// Apply runs colmena apply with the generated hive
-func (c *ColmenaExecutor) Apply(hivePath string) error {
-	args := []string{"apply", "--on", "target-node", "-f", hivePath}
+// nodeSSHOptions returns the deployment.sshOptions line of an instance's
+// node: host key verification against the project's known_hosts (unless
+// SSH_CONFIG_PATH is set) and the connection through its bastion
+func nodeSSHOptions(inst *InstanceInfo) (string, error) {
+	var options []string
+	if GetSSHConfigPath() == "" {
+		hostKeyOpts, err := hostKeyOptions(inst)
+		if err != nil {
+			return "", err
+		}
+		options = append(options, optionArgs(hostKeyOpts)...)
+	}
+	jumpOpts, err := jumpOptions(inst)
+	if err != nil {
+		return "", err
+	}
+	options = append(options, optionArgs(jumpOpts)...)
+	if len(options) == 0 {
+		return "", nil
+	}
+
+	quoted := make([]string, len(options))
+	for i, option := range options {
+		quoted[i] = fmt.Sprintf("%q", option)
+	}
+	return fmt.Sprintf("\n    deployment.sshOptions = [ %s ];", strings.Join(quoted, " ")), nil
+}
+
+// Apply runs colmena apply with the generated hive on the given nodes.
+// If no nodes are given, every node in the hive is deployed.
+func (c *ColmenaExecutor) Apply(hivePath string, nodes []string) error {
+	args := []string{"apply", "-f", hivePath}
+	if len(nodes) > 0 {
+		args = append(args, "--on", strings.Join(nodes, ","))
+	}
 
 	// Add SSH config file if SSH_CONFIG_PATH is set (takes precedence)
 	if sshConfigPath := GetSSHConfigPath(); sshConfigPath != "" {
@@ -81,18 +155,16 @@ func (c *ColmenaExecutor) Apply(hivePath string) error {
 	} else if sshKeyPath := GetSSHKeyPath(); sshKeyPath != "" {
 		// Fall back to SSH key option if SSH_KEY_PATH is set
 		args = append(args, "--ssh-option", fmt.Sprintf("IdentityFile=%s", sshKeyPath))
-		// Also disable strict host key checking for new hosts
-		args = append(args, "--ssh-option", "StrictHostKeyChecking=accept-new")
 	}
 
-	cmd := exec.Command("colmena", args...)
+	cmd := &Command{Name: "colmena", Args: args}
 	cmd.Dir = c.workDir
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = c.stdout
 	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	cmd.Stdin = stdin()
 	cmd.Env = os.Environ()
 
-	if err := cmd.Run(); err != nil {
+	if err := c.runner.Run(cmd); err != nil {
 		return fmt.Errorf("colmena apply failed: %w", err)
 	}
 
@@ -103,14 +175,14 @@ func (c *ColmenaExecutor) Apply(hivePath string) error {
 func (c *ColmenaExecutor) ApplyWithTag(project string) error {
 	tag := fmt.Sprintf("@project-%s", project)
 
-	cmd := exec.Command("colmena", "apply", "--on", tag)
+	cmd := &Command{Name: "colmena", Args: []string{"apply", "--on", tag}}
 	cmd.Dir = c.workDir
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = c.stdout
 	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	cmd.Stdin = stdin()
 	cmd.Env = os.Environ()
 
-	if err := cmd.Run(); err != nil {
+	if err := c.runner.Run(cmd); err != nil {
 		return fmt.Errorf("colmena apply failed: %w", err)
 	}
 
@@ -129,15 +201,42 @@ func (c *ColmenaExecutor) GetHivePath() string {
 	return filepath.Join(c.workDir, HiveFileName)
 }
 
+// toplevelExpr evaluates the system toplevel store path of every node
+const toplevelExpr = `{ nodes, ... }: builtins.mapAttrs (name: node: node.config.system.build.toplevel.outPath) nodes`
+
+// EvalToplevels evaluates the expected system toplevel store path of every
+// node in the hive, keyed by node name, without building anything
+func (c *ColmenaExecutor) EvalToplevels(hivePath string) (map[string]string, error) {
+	var stderr bytes.Buffer
+	cmd := &Command{Name: "colmena", Args: []string{"eval", "-f", hivePath, "-E", toplevelExpr}}
+	cmd.Dir = c.workDir
+	cmd.Env = os.Environ()
+	cmd.Stderr = &stderr
+
+	output, err := c.runner.Output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("colmena eval failed: %w\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var toplevels map[string]string
+	if err := json.Unmarshal(output, &toplevels); err != nil {
+		return nil, fmt.Errorf("failed to parse colmena eval output: %w", err)
+	}
+
+	return toplevels, nil
+}
+
 // ValidateHive checks if the hive.nix is valid by running colmena eval
 func (c *ColmenaExecutor) ValidateHive(hivePath string) error {
-	cmd := exec.Command("colmena", "eval", "-f", hivePath, "-E", "{ nodes, ... }: nodes")
+	cmd := &Command{Name: "colmena", Args: []string{"eval", "-f", hivePath, "-E", "{ nodes, ... }: nodes"}}
 	cmd.Dir = c.workDir
 	cmd.Env = os.Environ()
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("hive validation failed: %w\n%s", err, strings.TrimSpace(string(output)))
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := c.runner.Run(cmd); err != nil {
+		return fmt.Errorf("hive validation failed: %w\n%s", err, strings.TrimSpace(output.String()))
 	}
 
 	return nil
@@ -0,0 +1,162 @@
+package orchestrator
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestGenerateHive(t *testing.T) {
+	setupWorkspace(t)
+
+	colmenaExec, err := NewColmenaExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modules := &MachineModules{
+		Default:   "/modules/default.nix",
+		Common:    []string{"/modules/common.nix"},
+		Instances: map[string]string{"db-1": "/modules/db-1.nix"},
+	}
+	instances := []*InstanceInfo{
+		{ProjectName: "prod", InstanceName: "db-1", PublicIP: "10.0.0.2"},
+		{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.1"},
+		{ProjectName: "prod", InstanceName: "web-2", PrivateIP: "10.1.0.2", SSHUser: "ubuntu", SSHPort: 2222},
+	}
+
+	hivePath, err := colmenaExec.GenerateHive(modules, instances)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hivePath != colmenaExec.GetHivePath() {
+		t.Errorf("hivePath = %q, want %q", hivePath, colmenaExec.GetHivePath())
+	}
+
+	data, err := os.ReadFile(hivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hive := string(data)
+
+	for _, want := range []string{
+		`"db-1" = { ... }: {`,
+		`imports = [ (import "/modules/common.nix") (import "/modules/db-1.nix") ];`,
+		`deployment.targetHost = "10.0.0.2";`,
+		`"web-1" = { ... }: {`,
+		`imports = [ (import "/modules/common.nix") (import "/modules/default.nix") ];`,
+		`deployment.targetHost = "10.0.0.1";`,
+		`deployment.targetUser = "root";`,
+		`deployment.targetPort = 22;`,
+		`deployment.targetHost = "10.1.0.2";`,
+		`deployment.targetUser = "ubuntu";`,
+		`deployment.targetPort = 2222;`,
+	} {
+		if !strings.Contains(hive, want) {
+			t.Errorf("hive missing %q:\n%s", want, hive)
+		}
+	}
+}
+
+func TestGenerateHiveLegacySingleInstance(t *testing.T) {
+	setupWorkspace(t)
+
+	colmenaExec, err := NewColmenaExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hivePath, err := colmenaExec.GenerateHive(
+		&MachineModules{Default: "/modules/machine.nix"},
+		[]*InstanceInfo{{ProjectName: "prod", PublicIP: "1.2.3.4"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(hivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"`+DefaultNodeName+`" = { ... }: {`) {
+		t.Errorf("hive missing %s node:\n%s", DefaultNodeName, data)
+	}
+}
+
+func TestGenerateHiveErrors(t *testing.T) {
+	setupWorkspace(t)
+
+	colmenaExec, err := NewColmenaExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := colmenaExec.GenerateHive(&MachineModules{Default: "/m.nix"}, nil); err == nil {
+		t.Error("expected error for no instances")
+	}
+
+	_, err = colmenaExec.GenerateHive(
+		&MachineModules{Instances: map[string]string{"web-1": "/web.nix"}},
+		[]*InstanceInfo{{ProjectName: "prod", InstanceName: "db-1", PublicIP: "10.0.0.2"}},
+	)
+	if err == nil || !strings.Contains(err.Error(), "no machine module for instance prod/db-1") {
+		t.Errorf("error = %v, want missing module error", err)
+	}
+
+	// Common modules alone would deploy a bare system
+	_, err = colmenaExec.GenerateHive(
+		&MachineModules{Common: []string{"/common.nix"}, Instances: map[string]string{"web-1": "/web.nix"}},
+		[]*InstanceInfo{{ProjectName: "prod", InstanceName: "db-1", PublicIP: "10.0.0.2"}},
+	)
+	if err == nil || !strings.Contains(err.Error(), "no machine module for instance prod/db-1") {
+		t.Errorf("error with only common modules = %v, want missing module error", err)
+	}
+}
+
+func TestColmenaApply(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("SSH_CONFIG_PATH", "")
+	t.Setenv("SSH_KEY_PATH", "/keys/id_ed25519")
+
+	colmenaExec, err := NewColmenaExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := orchestratortest.NewFakeRunner()
+	colmenaExec.SetRunner(fake)
+
+	if err := colmenaExec.Apply("/hive.nix", []string{"web-1", "db-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := strings.Join(fake.CommandLines(), "; ")
+	want := "colmena apply -f /hive.nix --on web-1,db-1 --ssh-option IdentityFile=/keys/id_ed25519"
+	if got != want {
+		t.Errorf("command = %q, want %q", got, want)
+	}
+}
+
+func TestEvalToplevels(t *testing.T) {
+	setupWorkspace(t)
+
+	colmenaExec, err := NewColmenaExecutor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := orchestratortest.NewFakeRunner()
+	fake.On("colmena eval", orchestratortest.FakeResponse{Stdout: `{"web-1": "/nix/store/aaa-nixos-system", "db-1": "/nix/store/bbb-nixos-system"}`})
+	colmenaExec.SetRunner(fake)
+
+	toplevels, err := colmenaExec.EvalToplevels("/hive.nix")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if toplevels["web-1"] != "/nix/store/aaa-nixos-system" || toplevels["db-1"] != "/nix/store/bbb-nixos-system" {
+		t.Errorf("toplevels = %v", toplevels)
+	}
+	if args := fake.Calls()[0].Args; args[0] != "eval" || args[2] != "/hive.nix" {
+		t.Errorf("args = %v", args)
+	}
+}
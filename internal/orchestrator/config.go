@@ -2,6 +2,7 @@ package orchestrator
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 )
@@ -24,34 +25,173 @@ const (
 
 	// DefaultProjectName is used when PROJECT_NAME is not set
 	DefaultProjectName = "default"
+
+	// DefaultSSHUser is used when no SSH user is configured
+	DefaultSSHUser = "root"
+
+	// DefaultNodeName is the hive node name for single-instance projects (legacy public_ip)
+	DefaultNodeName = "target-node"
 )
 
-// GetProjectName returns the project name from environment or default
-func GetProjectName() string {
-	projectName := os.Getenv("PROJECT_NAME")
-	if projectName == "" {
-		return DefaultProjectName
+// nonInteractive is set by the --non-interactive/--auto-approve flags
+var nonInteractive bool
+
+// SetNonInteractive enables or disables non-interactive mode
+func SetNonInteractive(enabled bool) {
+	nonInteractive = enabled
+}
+
+// IsNonInteractive reports whether inframan must never prompt, either because
+// --non-interactive was given or INFRAMAN_NON_INTERACTIVE is set
+func IsNonInteractive() bool {
+	if nonInteractive {
+		return true
+	}
+	switch os.Getenv("INFRAMAN_NON_INTERACTIVE") {
+	case "", "0", "false":
+		return false
+	default:
+		return true
 	}
-	return projectName
 }
 
-// GetSSHKeyPath returns the SSH key path from environment, or empty string if not set
+// stdin returns the stdin to wire into child processes, or nil in
+// non-interactive mode so that any prompt fails instead of hanging
+func stdin() io.Reader {
+	if IsNonInteractive() {
+		return nil
+	}
+	return os.Stdin
+}
+
+// projectNameOverride is set by the --project flag
+var projectNameOverride string
+
+// SetProjectName overrides the project name for this run
+func SetProjectName(name string) {
+	projectNameOverride = name
+}
+
+// GetProjectName returns the project name. Precedence: --project flag,
+// PROJECT_NAME, default_project in inframan.json, then "default".
+func GetProjectName() string {
+	return firstNonEmpty(
+		projectNameOverride,
+		os.Getenv("PROJECT_NAME"),
+		currentProjectFile().DefaultProject,
+		DefaultProjectName,
+	)
+}
+
+// GetInfraConfigPath returns the Terranix JSON config path from INFRA_CONFIG_JSON
+// or inframan.json, or empty string if not set
+func GetInfraConfigPath() string {
+	return firstNonEmpty(os.Getenv("INFRA_CONFIG_JSON"), currentProjectConfig().InfraConfig)
+}
+
+// GetNixOSModulePath returns the machine module path from NIXOS_MODULE_PATH
+// or inframan.json, or empty string if not set
+func GetNixOSModulePath() string {
+	return firstNonEmpty(os.Getenv("NIXOS_MODULE_PATH"), currentProjectConfig().MachineModules)
+}
+
+// GetSSHKeyPath returns the SSH key path from SSH_KEY_PATH or inframan.json, or empty string if not set
 func GetSSHKeyPath() string {
-	return os.Getenv("SSH_KEY_PATH")
+	return projectSSHConfig(GetProjectName()).KeyPath
 }
 
-// GetSSHConfigPath returns the SSH config file path from environment, or empty string if not set
+// GetSSHConfigPath returns the SSH config file path from SSH_CONFIG_PATH or inframan.json, or empty string if not set
 func GetSSHConfigPath() string {
-	return os.Getenv("SSH_CONFIG_PATH")
+	return projectSSHConfig(GetProjectName()).ConfigPath
 }
 
-// GetInframanDir returns the absolute path to the .inframan directory
-func GetInframanDir() (string, error) {
+// GetSSHUser returns the SSH user from SSH_USER or inframan.json, defaulting to root
+func GetSSHUser() string {
+	return projectSSHConfig(GetProjectName()).User
+}
+
+// projectSSHConfig returns the SSH settings of a project, which need not be
+// the current one: SSH_USER, SSH_KEY_PATH, SSH_CONFIG_PATH and SSH_BASTION
+// override the project's ssh settings in inframan.json, and the user
+// defaults to root
+func projectSSHConfig(projectName string) SSHConfig {
+	ssh := currentProjectFile().Project(projectName).SSH
+	return SSHConfig{
+		User:       firstNonEmpty(os.Getenv("SSH_USER"), ssh.User, DefaultSSHUser),
+		KeyPath:    firstNonEmpty(os.Getenv("SSH_KEY_PATH"), ssh.KeyPath),
+		ConfigPath: firstNonEmpty(os.Getenv("SSH_CONFIG_PATH"), ssh.ConfigPath),
+		Bastion:    firstNonEmpty(os.Getenv("SSH_BASTION"), ssh.Bastion),
+	}
+}
+
+// workspaceRootOverride is set by the --workspace flag
+var workspaceRootOverride string
+
+// SetWorkspaceRoot overrides workspace root discovery
+func SetWorkspaceRoot(path string) {
+	workspaceRootOverride = path
+}
+
+// Entries that mark a directory as the workspace root. A directory with
+// inframan state or config wins over a nearer flake.nix or .git, which may
+// belong to a sub-flake or git submodule.
+var (
+	workspaceMarkers         = []string{InframanDir, ProjectFileName}
+	workspaceFallbackMarkers = []string{"flake.nix", ".git"}
+)
+
+// GetWorkspaceRoot returns the absolute path of the directory holding .inframan.
+// Precedence: --workspace flag, INFRAMAN_ROOT, then the nearest directory at or
+// above the working directory containing .inframan or inframan.json, else the
+// nearest one containing flake.nix or .git. If none is found, the working
+// directory is used.
+func GetWorkspaceRoot() (string, error) {
+	if root := firstNonEmpty(workspaceRootOverride, os.Getenv("INFRAMAN_ROOT")); root != "" {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return "", fmt.Errorf("failed to get absolute path of workspace root: %w", err)
+		}
+		return absRoot, nil
+	}
+
 	cwd, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("failed to get working directory: %w", err)
 	}
-	return filepath.Join(cwd, InframanDir), nil
+
+	if dir, ok := findMarkedDir(cwd, workspaceMarkers); ok {
+		return dir, nil
+	}
+	if dir, ok := findMarkedDir(cwd, workspaceFallbackMarkers); ok {
+		return dir, nil
+	}
+	return cwd, nil
+}
+
+// findMarkedDir returns the nearest directory at or above dir containing one
+// of markers
+func findMarkedDir(dir string, markers []string) (string, bool) {
+	for {
+		for _, marker := range markers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return dir, true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// GetInframanDir returns the absolute path to the .inframan directory in the workspace root
+func GetInframanDir() (string, error) {
+	root, err := GetWorkspaceRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, InframanDir), nil
 }
 
 // GetProjectDir returns the absolute path to the project-specific directory
@@ -138,17 +278,7 @@ func GetAllProjectDirs() ([]string, error) {
 			continue
 		}
 
-		// Check if this project has been initialized (works with any backend type)
-		// We check for .terraform/ directory (created by terraform init) or config.tf.json
-		terraformDir := filepath.Join(inframanDir, entry.Name(), TerraformSubdir)
-		terraformInitDir := filepath.Join(terraformDir, ".terraform")
-		configPath := filepath.Join(terraformDir, ConfigFileName)
-
-		// Project is valid if terraform has been initialized OR config exists
-		_, initErr := os.Stat(terraformInitDir)
-		_, configErr := os.Stat(configPath)
-
-		if initErr == nil || configErr == nil {
+		if isProjectDir(filepath.Join(inframanDir, entry.Name())) {
 			projects = append(projects, entry.Name())
 		}
 	}
@@ -156,6 +286,25 @@ func GetAllProjectDirs() ([]string, error) {
 	return projects, nil
 }
 
+// isProjectDir reports whether a directory under .inframan/ holds an
+// initialized project (works with any backend type): terraform init created
+// .terraform/ in its terraform/ subdirectory, or config.tf.json exists
+func isProjectDir(projectDir string) bool {
+	terraformDir := filepath.Join(projectDir, TerraformSubdir)
+	_, initErr := os.Stat(filepath.Join(terraformDir, ".terraform"))
+	_, configErr := os.Stat(filepath.Join(terraformDir, ConfigFileName))
+	return initErr == nil || configErr == nil
+}
+
+// ProjectExists reports whether a project has been initialized under .inframan/
+func ProjectExists(projectName string) (bool, error) {
+	inframanDir, err := GetInframanDir()
+	if err != nil {
+		return false, err
+	}
+	return isProjectDir(filepath.Join(inframanDir, projectName)), nil
+}
+
 // GetTerraformDirForProject returns the terraform directory for a specific project
 func GetTerraformDirForProject(projectName string) (string, error) {
 	inframanDir, err := GetInframanDir()
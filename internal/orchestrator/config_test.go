@@ -0,0 +1,122 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetAllProjectDirs(t *testing.T) {
+	setupWorkspace(t)
+
+	// No .inframan directory yet
+	projects, err := GetAllProjectDirs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(projects) != 0 {
+		t.Fatalf("projects = %v, want none", projects)
+	}
+
+	// Initialized project
+	createProject(t, "alpha")
+
+	// Project with only a config
+	betaDir := mustTerraformDir(t, "beta")
+	if err := os.MkdirAll(betaDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(betaDir, ConfigFileName), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty project directory and a stray file are ignored
+	if err := os.MkdirAll(mustTerraformDir(t, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	inframanDir, err := GetInframanDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(inframanDir, "stray"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	projects, err = GetAllProjectDirs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(projects, ","); got != "alpha,beta" {
+		t.Errorf("projects = %q, want %q", got, "alpha,beta")
+	}
+}
+
+func TestGetWorkspaceRoot(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("INFRAMAN_ROOT", "")
+
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "flake.nix"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "modules", "web")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(sub); err != nil {
+		t.Fatal(err)
+	}
+
+	// Running from a subdirectory finds the flake root
+	got, err := GetInframanDir()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(root, InframanDir); got != want {
+		t.Errorf("GetInframanDir() = %q, want %q", got, want)
+	}
+
+	// An existing .inframan above wins over a nearer sub-flake or submodule
+	if err := os.MkdirAll(filepath.Join(root, InframanDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(root, "modules")
+	if err := os.WriteFile(filepath.Join(nested, "flake.nix"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(nested, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	got, err = GetWorkspaceRoot()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != root {
+		t.Errorf("GetWorkspaceRoot() with nested flake = %q, want %q", got, root)
+	}
+
+	// INFRAMAN_ROOT overrides discovery
+	t.Setenv("INFRAMAN_ROOT", sub)
+	got, err = GetWorkspaceRoot()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != sub {
+		t.Errorf("GetWorkspaceRoot() = %q, want %q", got, sub)
+	}
+
+	// The --workspace flag overrides INFRAMAN_ROOT
+	SetWorkspaceRoot(root)
+	t.Cleanup(func() { SetWorkspaceRoot("") })
+	got, err = GetWorkspaceRoot()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != root {
+		t.Errorf("GetWorkspaceRoot() = %q, want %q", got, root)
+	}
+}
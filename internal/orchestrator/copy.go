@@ -0,0 +1,96 @@
+package orchestrator
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CopyOptions configures a file copy to or from an instance
+type CopyOptions struct {
+	SSH SSHOptions
+
+	// Recursive copies directories (scp -r)
+	Recursive bool
+
+	// Rsync copies with rsync -az instead of scp, transferring only changed
+	// files; directories are always copied recursively
+	Rsync bool
+}
+
+// Copy copies a local path to a path on an instance (upload) or a path on an
+// instance to a local path, with the same identity, user, bastion and host
+// key checking as SSHArgs
+func Copy(inst *InstanceInfo, opts CopyOptions, local, remote string, upload bool) error {
+	cmd, err := copyCommand(inst, opts, local, remote, upload)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = stdin()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := DefaultRunner.Run(cmd); err != nil {
+		return fmt.Errorf("%s failed: %w", cmd.Name, err)
+	}
+	return nil
+}
+
+// copyCommand returns the scp or rsync command for Copy
+func copyCommand(inst *InstanceInfo, opts CopyOptions, local, remote string, upload bool) (*Command, error) {
+	sshArgs, user, host, err := sshConnection(inst, opts.SSH)
+	if err != nil {
+		return nil, err
+	}
+
+	// IPv6 addresses are bracketed so the path separator stays unambiguous
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	remoteSpec := user + "@" + host + ":" + remote
+	src, dst := remoteSpec, local
+	if upload {
+		src, dst = local, remoteSpec
+	}
+
+	cmd := &Command{Name: "scp", Env: os.Environ()}
+	if opts.Rsync {
+		shell := append([]string{"ssh"}, sshArgs...)
+		if inst.SSHPort != 0 {
+			shell = append(shell, "-p", strconv.Itoa(inst.SSHPort))
+		}
+		cmd.Name = "rsync"
+		cmd.Args = []string{"-az", "-e", rsyncShell(shell)}
+	} else {
+		cmd.Args = sshArgs
+		if opts.Recursive {
+			cmd.Args = append(cmd.Args, "-r")
+		}
+		if inst.SSHPort != 0 {
+			cmd.Args = append(cmd.Args, "-P", strconv.Itoa(inst.SSHPort))
+		}
+	}
+	cmd.Args = append(cmd.Args, src, dst)
+
+	return cmd, nil
+}
+
+// safeShellArg matches arguments that need no quoting in rsync's -e option
+var safeShellArg = regexp.MustCompile(`^[A-Za-z0-9@%+=:,./_-]+$`)
+
+// rsyncShell joins the remote shell command for rsync's -e option. rsync
+// splits it on spaces and keeps quoted arguments together; a quote inside
+// quotes is doubled.
+func rsyncShell(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if safeShellArg.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
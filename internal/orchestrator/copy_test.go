@@ -0,0 +1,75 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCopyCommand(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("SSH_CONFIG_PATH", "")
+	t.Setenv("SSH_USER", "")
+	t.Setenv("SSH_KEY_PATH", "/keys/my key")
+	knownHosts, err := GetKnownHostsPath("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.1", SSHPort: 2222}
+	hostKeyArgs := "-o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=" + knownHosts + " -o HostKeyAlias=prod/web-1 -o LogLevel=ERROR"
+
+	tests := []struct {
+		name   string
+		opts   CopyOptions
+		upload bool
+		want   string
+	}{
+		{
+			name:   "scp upload",
+			upload: true,
+			want:   "scp -i /keys/my key " + hostKeyArgs + " -P 2222 ./app.env root@10.0.0.1:/etc/app.env",
+		},
+		{
+			name: "recursive scp download",
+			opts: CopyOptions{Recursive: true, SSH: SSHOptions{User: "nixos"}},
+			want: "scp -i /keys/my key " + hostKeyArgs + " -r -P 2222 nixos@10.0.0.1:/etc/app.env ./app.env",
+		},
+		{
+			name:   "rsync",
+			opts:   CopyOptions{Rsync: true},
+			upload: true,
+			want:   "rsync -az -e ssh -i '/keys/my key' " + hostKeyArgs + " -p 2222 ./app.env root@10.0.0.1:/etc/app.env",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := copyCommand(inst, tt.opts, "./app.env", "/etc/app.env", tt.upload)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := cmd.String(); got != tt.want {
+				t.Errorf("command = %q\nwant      %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyCommandIPv6(t *testing.T) {
+	setupWorkspace(t)
+	inst := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "2001:db8::1"}
+
+	cmd, err := copyCommand(inst, CopyOptions{}, "out.txt", "in.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cmd.String(); !strings.HasSuffix(got, " root@[2001:db8::1]:in.txt out.txt") {
+		t.Errorf("command = %q", got)
+	}
+}
+
+func TestRsyncShell(t *testing.T) {
+	got := rsyncShell([]string{"ssh", "-i", "/keys/it's mine", "-o", "LogLevel=ERROR"})
+	if want := "ssh -i '/keys/it''s mine' -o LogLevel=ERROR"; got != want {
+		t.Errorf("rsyncShell() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package orchestrator
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// EngineTerraform is the HashiCorp Terraform engine
+	EngineTerraform = "terraform"
+
+	// EngineTofu is the OpenTofu engine
+	EngineTofu = "tofu"
+
+	// EngineFileName records the engine a project was initialized with
+	EngineFileName = "engine"
+)
+
+// Engine is the IaC binary used to init, plan, apply and destroy a project.
+// Terraform and OpenTofu share the same CLI, so only the binary differs.
+type Engine struct {
+	Name   string // EngineTerraform or EngineTofu
+	Binary string // Binary name or path
+}
+
+// GetEngineName returns the engine name from INFRAMAN_ENGINE or inframan.json, or empty string if not set
+func GetEngineName() string {
+	return firstNonEmpty(os.Getenv("INFRAMAN_ENGINE"), currentProjectConfig().Engine)
+}
+
+// GetEngineBinary returns the engine binary override from INFRAMAN_ENGINE_PATH or inframan.json, or empty string if not set
+func GetEngineBinary() string {
+	return firstNonEmpty(os.Getenv("INFRAMAN_ENGINE_PATH"), currentProjectConfig().EnginePath)
+}
+
+// ResolveEngine determines the engine for a project. For the current project,
+// INFRAMAN_ENGINE and INFRAMAN_ENGINE_PATH take precedence, then the project's
+// settings in inframan.json. Otherwise the engine recorded when the project
+// was initialized is used, and as a last resort whichever of terraform or
+// tofu is found on PATH.
+func ResolveEngine(projectName string) (*Engine, error) {
+	var name, binary string
+	if projectName == GetProjectName() {
+		name = GetEngineName()
+		binary = GetEngineBinary()
+	} else {
+		project := currentProjectFile().Project(projectName)
+		name = project.Engine
+		binary = project.EnginePath
+	}
+
+	// Infer the engine from the binary override (e.g. /opt/bin/tofu)
+	if name == "" && binary != "" {
+		if strings.HasPrefix(filepath.Base(binary), EngineTofu) {
+			name = EngineTofu
+		} else {
+			name = EngineTerraform
+		}
+	}
+
+	if name == "" {
+		recorded, err := readRecordedEngine(projectName)
+		if err != nil {
+			return nil, err
+		}
+		name = recorded
+	}
+
+	if name == "" {
+		detected, err := detectEngine()
+		if err != nil {
+			return nil, err
+		}
+		name = detected
+	}
+
+	if name != EngineTerraform && name != EngineTofu {
+		return nil, fmt.Errorf("unknown engine %q (expected %q or %q)", name, EngineTerraform, EngineTofu)
+	}
+
+	if binary == "" {
+		binary = name
+	}
+
+	return &Engine{Name: name, Binary: binary}, nil
+}
+
+// detectEngine returns the first engine found on PATH, preferring terraform
+func detectEngine() (string, error) {
+	for _, name := range []string{EngineTerraform, EngineTofu} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("neither %s nor %s found in PATH", EngineTerraform, EngineTofu)
+}
+
+// readRecordedEngine returns the engine recorded for a project, or empty string if none
+func readRecordedEngine(projectName string) (string, error) {
+	inframanDir, err := GetInframanDir()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(inframanDir, projectName, EngineFileName))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read engine for project %q: %w", projectName, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// recordEngine saves the engine a project was initialized with, so commands
+// acting on other projects (e.g. ssh --list) use the same engine
+func recordEngine(projectName string, engine *Engine) error {
+	inframanDir, err := GetInframanDir()
+	if err != nil {
+		return err
+	}
+
+	enginePath := filepath.Join(inframanDir, projectName, EngineFileName)
+	if err := os.WriteFile(enginePath, []byte(engine.Name+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record engine: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHealthTimeout is how long failing health checks of an instance
+	// are retried
+	DefaultHealthTimeout = 2 * time.Minute
+
+	// defaultHealthInterval is the delay between retries of a check with
+	// explicit retries and no interval
+	defaultHealthInterval = 5 * time.Second
+)
+
+// HealthCheck is a check run against an instance after it was deployed.
+// Exactly one of HTTP, TCP, Systemd and Command is set.
+type HealthCheck struct {
+	// Name labels the check in reports (default: a description of the check)
+	Name string `json:"name,omitempty"`
+
+	// HTTP is a URL that must answer with Status (default: any 2xx or 3xx).
+	// {ip} is replaced by the instance's IP, e.g. http://{ip}:8080/healthz
+	HTTP   string `json:"http,omitempty"`
+	Status int    `json:"status,omitempty"`
+
+	// TCP is a port on the instance that must accept connections
+	TCP int `json:"tcp,omitempty"`
+
+	// Systemd is a unit on the instance that must be active
+	Systemd string `json:"systemd,omitempty"`
+
+	// Command is run on the instance over SSH and must exit 0
+	Command string `json:"command,omitempty"`
+
+	// Retries is how often a failing check is retried, Interval (a Go
+	// duration such as "5s") apart. Without retries, a failing check is
+	// retried with backoff. Retries never extend past the health timeout.
+	Retries  int    `json:"retries,omitempty"`
+	Interval string `json:"interval,omitempty"`
+}
+
+// String describes the check for progress and error messages
+func (c *HealthCheck) String() string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.HTTP != "":
+		return "http " + c.HTTP
+	case c.TCP != 0:
+		return "tcp " + strconv.Itoa(c.TCP)
+	case c.Systemd != "":
+		return "systemd " + c.Systemd
+	default:
+		return "command " + strconv.Quote(c.Command)
+	}
+}
+
+// Validate checks that exactly one kind of check is configured
+func (c *HealthCheck) Validate() error {
+	kinds := 0
+	for _, set := range []bool{c.HTTP != "", c.TCP != 0, c.Systemd != "", c.Command != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("health check must set exactly one of http, tcp, systemd and command")
+	}
+	if c.TCP < 0 || c.TCP > 65535 {
+		return fmt.Errorf("invalid health check port %d", c.TCP)
+	}
+	if c.Status != 0 && c.HTTP == "" {
+		return fmt.Errorf("health check status is only valid for http checks")
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("health check %s: retries must not be negative", c)
+	}
+	if c.Interval != "" {
+		if _, err := time.ParseDuration(c.Interval); err != nil {
+			return fmt.Errorf("health check %s: invalid interval: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// interval returns the delay between explicit retries
+func (c *HealthCheck) interval() time.Duration {
+	if d, err := time.ParseDuration(c.Interval); err == nil {
+		return d
+	}
+	return defaultHealthInterval
+}
+
+// checkReachable returns an error if the check cannot reach an instance.
+// http and tcp checks connect directly from this machine, so they cannot
+// check an instance that has no public IP and is reached through a bastion.
+func (c *HealthCheck) checkReachable(inst *InstanceInfo) error {
+	if (c.HTTP == "" && c.TCP == 0) || inst.PublicIP != "" {
+		return nil
+	}
+	jump, err := ResolveJump(inst)
+	if err != nil || jump == "" {
+		return err
+	}
+	return fmt.Errorf("health check %s cannot reach %s, which is only reachable through bastion %s; use a command or systemd check instead", c, inst.FullName(), jump)
+}
+
+// ValidateHealthChecks returns an error if a check cannot run against one
+// of the instances, so that a deploy fails before changing anything rather
+// than on its health checks
+func ValidateHealthChecks(instances []*InstanceInfo, checks []HealthCheck) error {
+	for _, inst := range instances {
+		for i := range checks {
+			if err := checks[i].checkReachable(inst); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Run runs the check once against an instance
+func (c *HealthCheck) Run(inst *InstanceInfo) error {
+	if err := c.checkReachable(inst); err != nil {
+		return err
+	}
+
+	switch {
+	case c.HTTP != "":
+		return c.runHTTP(inst)
+	case c.TCP != 0:
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(inst.Address(), strconv.Itoa(c.TCP)), probeTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case c.Systemd != "":
+		return c.runSystemd(inst)
+	default:
+		_, err := RunRemote(inst, SSHOptions{}, c.Command)
+		return err
+	}
+}
+
+// runSystemd checks that the check's unit is active on the instance
+func (c *HealthCheck) runSystemd(inst *InstanceInfo) error {
+	output, err := RunRemote(inst, SSHOptions{}, "systemctl is-active "+c.Systemd)
+	var sshErr *SSHError
+	if err == nil || errors.As(err, &sshErr) {
+		return err
+	}
+
+	// systemctl prints the unit's state, e.g. "failed" or "inactive"
+	state := strings.TrimSpace(output)
+	if state == "" {
+		state = "not active"
+	}
+	return fmt.Errorf("unit %s is %s", c.Systemd, state)
+}
+
+// runHTTP requests the check's URL and verifies the response status
+func (c *HealthCheck) runHTTP(inst *InstanceInfo) error {
+	url := strings.ReplaceAll(c.HTTP, "{ip}", inst.Address())
+	client := &http.Client{Timeout: probeTimeout}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if c.Status != 0 {
+		if resp.StatusCode != c.Status {
+			return fmt.Errorf("%s returned %d, expected %d", url, resp.StatusCode, c.Status)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// Wait runs the check against an instance until it passes. A check with
+// explicit retries is retried at its interval; otherwise it is retried with
+// exponential backoff. Either way, it is not retried past deadline. Retries
+// are reported to progress. It returns the number of attempts and the last
+// error.
+func (c *HealthCheck) Wait(inst *InstanceInfo, deadline time.Time, progress io.Writer) (int, error) {
+	backoff := initialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := c.Run(inst)
+		if err == nil {
+			return attempt, nil
+		}
+
+		delay := backoff
+		if c.Retries > 0 {
+			if attempt > c.Retries {
+				return attempt, err
+			}
+			delay = c.interval()
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return attempt, err
+		}
+
+		fmt.Fprintf(progress, "  %-30s %s: %v, retrying in %s\n", inst.FullName(), c, err, delay)
+		time.Sleep(delay)
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// HealthResult is the outcome of one health check on one instance
+type HealthResult struct {
+	Instance *InstanceInfo
+	Check    *HealthCheck
+	Attempts int
+	Err      error
+}
+
+// CheckHealth runs every check against every instance, instances in
+// parallel, and returns the results ordered by instance, then check. The
+// checks of an instance share one deadline, timeout from now, after which
+// failing checks are no longer retried. Retries are reported to progress.
+func CheckHealth(instances []*InstanceInfo, checks []HealthCheck, timeout time.Duration, progress io.Writer) []*HealthResult {
+	results := make([]*HealthResult, len(instances)*len(checks))
+	deadline := time.Now().Add(timeout)
+
+	var wg sync.WaitGroup
+	for i, inst := range instances {
+		wg.Add(1)
+		go func(i int, inst *InstanceInfo) {
+			defer wg.Done()
+			for j := range checks {
+				check := &checks[j]
+				attempts, err := check.Wait(inst, deadline, progress)
+				results[i*len(checks)+j] = &HealthResult{Instance: inst, Check: check, Attempts: attempts, Err: err}
+			}
+		}(i, inst)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// GetHealthChecks returns the health checks of the current project from inframan.json
+func GetHealthChecks() []HealthCheck {
+	return currentProjectConfig().HealthChecks
+}
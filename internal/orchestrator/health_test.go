@@ -0,0 +1,188 @@
+package orchestrator
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestHealthCheckValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		check   HealthCheck
+		wantErr bool
+	}{
+		{name: "http", check: HealthCheck{HTTP: "http://{ip}/", Status: 204}},
+		{name: "tcp", check: HealthCheck{TCP: 443}},
+		{name: "command", check: HealthCheck{Command: "true"}},
+		{name: "none", check: HealthCheck{}, wantErr: true},
+		{name: "two kinds", check: HealthCheck{TCP: 443, Command: "true"}, wantErr: true},
+		{name: "bad port", check: HealthCheck{TCP: 70000}, wantErr: true},
+		{name: "status without http", check: HealthCheck{TCP: 80, Status: 200}, wantErr: true},
+		{name: "systemd with retries", check: HealthCheck{Systemd: "nginx.service", Retries: 5, Interval: "2s"}},
+		{name: "bad interval", check: HealthCheck{Systemd: "nginx.service", Interval: "soon"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.check.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthCheckRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	base := "http://{ip}:" + strconv.Itoa(port)
+
+	inst := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "127.0.0.1"}
+
+	tests := []struct {
+		name    string
+		check   HealthCheck
+		wantErr bool
+	}{
+		{name: "http ok", check: HealthCheck{HTTP: base + "/healthz"}},
+		{name: "http down", check: HealthCheck{HTTP: base + "/down"}, wantErr: true},
+		{name: "http expected status", check: HealthCheck{HTTP: base + "/down", Status: 503}},
+		{name: "http unexpected status", check: HealthCheck{HTTP: base + "/healthz", Status: 204}, wantErr: true},
+		{name: "tcp open", check: HealthCheck{TCP: port}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.check.Run(inst); (err != nil) != tt.wantErr {
+				t.Errorf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthCheckCommand(t *testing.T) {
+	fake := setupWorkspace(t)
+	fake.On("ssh", orchestratortest.FakeResponse{ExitCode: 3})
+	inst := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.1"}
+
+	check := &HealthCheck{Command: "systemctl is-active nginx"}
+	if err := check.Run(inst); err == nil {
+		t.Fatal("expected failing command to fail the check")
+	}
+	if line := fake.CommandLines()[0]; !strings.HasSuffix(line, "root@10.0.0.1 systemctl is-active nginx") {
+		t.Errorf("command = %q", line)
+	}
+
+	// A check without retries gives up once the deadline passed
+	if attempts, err := check.Wait(inst, time.Now(), io.Discard); err == nil || attempts != 1 {
+		t.Errorf("Wait() = (%d, %v), want one failed attempt", attempts, err)
+	}
+
+	// A check with retries is retried at its interval
+	check.Retries = 2
+	check.Interval = "1ms"
+	start := time.Now()
+	if attempts, err := check.Wait(inst, start.Add(time.Minute), io.Discard); err == nil || attempts != 3 {
+		t.Errorf("Wait() = (%d, %v), want three failed attempts", attempts, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Wait() should use the check's interval")
+	}
+
+	// Retries stop at the deadline
+	check.Retries = 30
+	check.Interval = "1h"
+	if attempts, err := check.Wait(inst, time.Now().Add(time.Second), io.Discard); err == nil || attempts != 1 {
+		t.Errorf("Wait() = (%d, %v), want one failed attempt before the deadline", attempts, err)
+	}
+}
+
+func TestHealthCheckSystemd(t *testing.T) {
+	fake := setupWorkspace(t)
+	inst := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.1"}
+	check := &HealthCheck{Systemd: "nginx.service"}
+
+	fake.On("ssh", orchestratortest.FakeResponse{Stdout: "failed\n", ExitCode: 3})
+	if err := check.Run(inst); err == nil || err.Error() != "unit nginx.service is failed" {
+		t.Errorf("Run() error = %v, want failed unit", err)
+	}
+
+	fake.On("ssh", orchestratortest.FakeResponse{ExitCode: 255})
+	var sshErr *SSHError
+	if err := check.Run(inst); !errors.As(err, &sshErr) {
+		t.Errorf("Run() error = %v, want *SSHError", err)
+	}
+
+	fake.On("ssh", orchestratortest.FakeResponse{Stdout: "active\n"})
+	if err := check.Run(inst); err != nil {
+		t.Errorf("Run() error = %v, want active unit", err)
+	}
+	if line := fake.CommandLines()[0]; !strings.HasSuffix(line, "systemctl is-active nginx.service") {
+		t.Errorf("command = %q", line)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	instances := []*InstanceInfo{
+		{ProjectName: "prod", InstanceName: "web-1", PublicIP: "127.0.0.1"},
+		{ProjectName: "prod", InstanceName: "web-2", PublicIP: "127.0.0.1"},
+	}
+	checks := []HealthCheck{{Name: "open", TCP: port}, {Name: "closed", HTTP: "http://{ip}:1/"}}
+
+	results := CheckHealth(instances, checks, 0, io.Discard)
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4", len(results))
+	}
+	for i, result := range results {
+		if result.Instance != instances[i/2] || result.Check.Name != checks[i%2].Name {
+			t.Errorf("result %d = %s on %s, out of order", i, result.Check, result.Instance.FullName())
+		}
+		if (result.Err != nil) != (result.Check.Name == "closed") {
+			t.Errorf("result %d error = %v", i, result.Err)
+		}
+	}
+}
+
+func TestValidateHealthChecksBehindBastion(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("SSH_BASTION", "admin@jump.example.com")
+	web := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "5.6.7.8", PrivateIP: "10.1.0.6"}
+	db := &InstanceInfo{ProjectName: "prod", InstanceName: "db-1", PrivateIP: "10.1.0.5"}
+
+	// Direct checks cannot reach an instance with only a private IP
+	err := ValidateHealthChecks([]*InstanceInfo{web, db}, []HealthCheck{{TCP: 5432}})
+	if err == nil || !strings.Contains(err.Error(), "cannot reach prod/db-1") {
+		t.Errorf("ValidateHealthChecks() error = %v, want unreachable prod/db-1", err)
+	}
+	if err := (&HealthCheck{HTTP: "http://{ip}/"}).Run(db); err == nil || !strings.Contains(err.Error(), "bastion admin@jump.example.com") {
+		t.Errorf("Run() error = %v, want unreachable through bastion", err)
+	}
+
+	// Checks run over SSH go through the bastion, and public IPs are reached directly
+	if err := ValidateHealthChecks([]*InstanceInfo{db}, []HealthCheck{{Command: "pg_isready"}, {Systemd: "postgresql.service"}}); err != nil {
+		t.Errorf("ValidateHealthChecks() with SSH checks = %v", err)
+	}
+	if err := ValidateHealthChecks([]*InstanceInfo{web}, []HealthCheck{{TCP: 443}}); err != nil {
+		t.Errorf("ValidateHealthChecks() with public instance = %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+// setupWorkspace runs the test in an empty temporary workspace with terraform
+// as the engine, "prod" as the current project and a fake runner installed
+// as DefaultRunner
+func setupWorkspace(t *testing.T) *orchestratortest.FakeRunner {
+	t.Helper()
+
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	t.Setenv("PROJECT_NAME", "prod")
+	t.Setenv("INFRAMAN_ROOT", dir)
+	t.Setenv("INFRAMAN_ENGINE", EngineTerraform)
+	t.Setenv("INFRAMAN_ENGINE_PATH", "")
+	t.Setenv("SSH_BASTION", "")
+
+	fake := orchestratortest.NewFakeRunner()
+	previous := DefaultRunner
+	DefaultRunner = fake
+	t.Cleanup(func() { DefaultRunner = previous })
+
+	return fake
+}
+
+// createProject creates an initialized project directory under .inframan/
+func createProject(t *testing.T, name string) string {
+	t.Helper()
+
+	terraformDir, err := GetTerraformDirForProject(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(terraformDir, ".terraform"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return terraformDir
+}
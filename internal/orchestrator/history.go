@@ -0,0 +1,153 @@
+package orchestrator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// HistoryFileName is the project history in .inframan/<project>/, one
+	// JSON entry per line
+	HistoryFileName = "history.jsonl"
+)
+
+// Outcomes recorded in the project history
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+)
+
+// HistoryEntry records one command run against a project
+type HistoryEntry struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"`
+	Command    string    `json:"command"`
+	GitCommit  string    `json:"git_commit,omitempty"`
+	ConfigHash string    `json:"config_hash,omitempty"`
+	ModulePath string    `json:"module_path,omitempty"`
+	Instances  []string  `json:"instances,omitempty"`
+	Generation int       `json:"generation,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// GetHistoryPath returns the path of a project's history file
+func GetHistoryPath(projectName string) (string, error) {
+	inframanDir, err := GetInframanDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(inframanDir, projectName, HistoryFileName), nil
+}
+
+// RecordHistory appends an entry to a project's history. The time, user,
+// workspace git commit and hash of the project's config.tf.json are filled
+// in, and the outcome is derived from runErr.
+func RecordHistory(projectName string, entry *HistoryEntry, runErr error) error {
+	entry.Time = time.Now().UTC()
+	entry.User = currentUser()
+	entry.GitCommit = workspaceGitCommit()
+	entry.Outcome = OutcomeSucceeded
+	if runErr != nil {
+		entry.Outcome = OutcomeFailed
+		entry.Error = runErr.Error()
+	}
+
+	historyPath, err := GetHistoryPath(projectName)
+	if err != nil {
+		return err
+	}
+
+	// The config may not exist yet, e.g. when infra failed before setup
+	terraformDir, err := GetTerraformDirForProject(projectName)
+	if err != nil {
+		return err
+	}
+	if hash, err := HashFile(filepath.Join(terraformDir, ConfigFileName)); err == nil {
+		entry.ConfigHash = hash
+	}
+
+	if err := EnsureDir(filepath.Dir(historyPath)); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %w", err)
+	}
+
+	f, err := os.OpenFile(historyPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to record history: %w", err)
+	}
+	return nil
+}
+
+// ReadHistory returns a project's history, oldest first. A project without
+// history has no entries.
+func ReadHistory(projectName string) ([]*HistoryEntry, error) {
+	historyPath, err := GetHistoryPath(projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(historyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var entries []*HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse %s line %d: %w", historyPath, line, err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	return entries, nil
+}
+
+// workspaceGitCommit returns the commit checked out in the workspace root,
+// suffixed with "-dirty" if there are uncommitted changes, or empty string
+// if the workspace is not a git repository
+func workspaceGitCommit() string {
+	root, err := GetWorkspaceRoot()
+	if err != nil {
+		return ""
+	}
+
+	output, err := DefaultRunner.Output(&Command{Name: "git", Args: []string{"rev-parse", "HEAD"}, Dir: root})
+	commit := strings.TrimSpace(string(output))
+	if err != nil || commit == "" {
+		return ""
+	}
+
+	status, err := DefaultRunner.Output(&Command{Name: "git", Args: []string{"status", "--porcelain"}, Dir: root})
+	if err == nil && strings.TrimSpace(string(status)) != "" {
+		commit += "-dirty"
+	}
+	return commit
+}
@@ -0,0 +1,67 @@
+package orchestrator
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestRecordHistory(t *testing.T) {
+	fake := setupWorkspace(t)
+	fake.On("git rev-parse HEAD", orchestratortest.FakeResponse{Stdout: "0123456789abcdef\n"})
+	fake.On("git status --porcelain", orchestratortest.FakeResponse{Stdout: " M main.tf\n"})
+
+	createProject(t, "prod")
+	terraformDir := mustTerraformDir(t, "prod")
+	if err := os.WriteFile(filepath.Join(terraformDir, ConfigFileName), []byte(`{"resource": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configHash, err := HashFile(filepath.Join(terraformDir, ConfigFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RecordHistory("prod", &HistoryEntry{Command: "deploy", ModulePath: "/modules", Instances: []string{"prod/web-1"}}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RecordHistory("prod", &HistoryEntry{Command: "rollback", Instances: []string{"prod/web-1"}, Generation: 41}, errors.New("boom")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := ReadHistory("prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d history entries, want 2", len(entries))
+	}
+
+	first, second := entries[0], entries[1]
+	if first.Command != "deploy" || first.Outcome != OutcomeSucceeded || first.ModulePath != "/modules" || first.Time.IsZero() || first.User == "" {
+		t.Errorf("first entry = %+v", first)
+	}
+	if first.GitCommit != "0123456789abcdef-dirty" {
+		t.Errorf("GitCommit = %q, want dirty commit", first.GitCommit)
+	}
+	if first.ConfigHash != configHash {
+		t.Errorf("ConfigHash = %q, want %q", first.ConfigHash, configHash)
+	}
+	if second.Outcome != OutcomeFailed || second.Error != "boom" || second.Generation != 41 {
+		t.Errorf("second entry = %+v", second)
+	}
+}
+
+func TestReadHistoryMissing(t *testing.T) {
+	setupWorkspace(t)
+
+	entries, err := ReadHistory("prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d entries, want none", len(entries))
+	}
+}
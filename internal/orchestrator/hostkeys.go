@@ -0,0 +1,272 @@
+package orchestrator
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// KnownHostsFileName is the name of a project's known_hosts file
+	KnownHostsFileName = "known_hosts"
+
+	// terraformKeyComment marks known_hosts entries seeded from the
+	// host_key terraform output, as opposed to keys pinned on first use
+	terraformKeyComment = "inframan:terraform"
+)
+
+// knownHostsMu serializes updates of known_hosts files by concurrent
+// connections, e.g. exec on many instances
+var knownHostsMu sync.Mutex
+
+// GetKnownHostsPath returns the path to a project's known_hosts file
+// Structure: .inframan/<project-name>/known_hosts
+func GetKnownHostsPath(projectName string) (string, error) {
+	inframanDir, err := GetInframanDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(inframanDir, projectName, KnownHostsFileName), nil
+}
+
+// HostKeyAlias returns the name under which an instance's host key is
+// stored in known_hosts. Keys are pinned per instance rather than per
+// address, so a changed IP keeps its key and a reused IP is not trusted.
+func HostKeyAlias(inst *InstanceInfo) string {
+	return inst.FullName()
+}
+
+// HostKeyEntry is a line of a known_hosts file
+type HostKeyEntry struct {
+	Host    string // Host key alias, see HostKeyAlias
+	Type    string // e.g. "ssh-ed25519"
+	Key     string // base64 public key
+	Comment string
+}
+
+// String formats the entry as a known_hosts line
+func (e *HostKeyEntry) String() string {
+	line := e.Host + " " + e.Type + " " + e.Key
+	if e.Comment != "" {
+		line += " " + e.Comment
+	}
+	return line
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key as printed by ssh-keygen -l
+func (e *HostKeyEntry) Fingerprint() string {
+	blob, err := base64.StdEncoding.DecodeString(e.Key)
+	if err != nil {
+		return "invalid key"
+	}
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// FromTerraform reports whether the entry was seeded from terraform output
+// rather than pinned on first use
+func (e *HostKeyEntry) FromTerraform() bool {
+	return e.Comment == terraformKeyComment
+}
+
+// parseHostKey parses a public key ("type base64 [comment]") into an entry for host
+func parseHostKey(host, key string) (*HostKeyEntry, error) {
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid host key %q", key)
+	}
+	if _, err := base64.StdEncoding.DecodeString(fields[1]); err != nil {
+		return nil, fmt.Errorf("invalid host key %q: %w", key, err)
+	}
+	return &HostKeyEntry{Host: host, Type: fields[0], Key: fields[1], Comment: terraformKeyComment}, nil
+}
+
+// ReadKnownHosts returns the entries of a project's known_hosts file, or
+// none if it does not exist. Comments and markers such as @revoked are skipped.
+func ReadKnownHosts(projectName string) ([]*HostKeyEntry, error) {
+	path, err := GetKnownHostsPath(projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	var entries []*HostKeyEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+			continue
+		}
+		entries = append(entries, &HostKeyEntry{
+			Host:    fields[0],
+			Type:    fields[1],
+			Key:     fields[2],
+			Comment: strings.Join(fields[3:], " "),
+		})
+	}
+	return entries, nil
+}
+
+// writeKnownHosts replaces a project's known_hosts file with entries
+func writeKnownHosts(projectName string, entries []*HostKeyEntry) error {
+	path, err := GetKnownHostsPath(projectName)
+	if err != nil {
+		return err
+	}
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	var data strings.Builder
+	for _, entry := range entries {
+		data.WriteString(entry.String() + "\n")
+	}
+
+	// Write atomically so a concurrent ssh never sees a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	return nil
+}
+
+// SeedHostKey pins the host keys of an instance's host_key terraform output
+// in its project's known_hosts, replacing any other keys of the instance:
+// terraform state is trusted over keys pinned on first use. It does nothing
+// for instances without a host_key output.
+func SeedHostKey(inst *InstanceInfo) error {
+	if inst.HostKey == "" {
+		return nil
+	}
+
+	alias := HostKeyAlias(inst)
+	var seeded []*HostKeyEntry
+	for _, key := range strings.Split(inst.HostKey, "\n") {
+		if strings.TrimSpace(key) == "" {
+			continue
+		}
+		entry, err := parseHostKey(alias, key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", inst.FullName(), err)
+		}
+		seeded = append(seeded, entry)
+	}
+
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	entries, err := ReadKnownHosts(inst.ProjectName)
+	if err != nil {
+		return err
+	}
+
+	var kept, previous []*HostKeyEntry
+	for _, entry := range entries {
+		if entry.Host == alias {
+			previous = append(previous, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	if sameKeys(previous, seeded) {
+		return nil
+	}
+	if len(previous) > 0 {
+		fmt.Fprintf(os.Stderr, "Replacing pinned host key of %s with the one from terraform output\n", inst.FullName())
+	}
+	return writeKnownHosts(inst.ProjectName, append(kept, seeded...))
+}
+
+// sameKeys reports whether two lists hold the same keys with the same origin
+func sameKeys(a, b []*HostKeyEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveHostKeys removes the entries of the given hosts from a project's
+// known_hosts and returns the removed entries
+func RemoveHostKeys(projectName string, match func(host string) bool) ([]*HostKeyEntry, error) {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	entries, err := ReadKnownHosts(projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept, removed []*HostKeyEntry
+	for _, entry := range entries {
+		if match(entry.Host) {
+			removed = append(removed, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	return removed, writeKnownHosts(projectName, kept)
+}
+
+// sshOption is an ssh_config option, passed to ssh as -o Key=Value
+type sshOption struct {
+	Key   string
+	Value string
+}
+
+// optionArgs converts options into ssh arguments
+func optionArgs(options []sshOption) []string {
+	var args []string
+	for _, option := range options {
+		args = append(args, "-o", option.Key+"="+option.Value)
+	}
+	return args
+}
+
+// hostKeyOptions returns the ssh options verifying an instance's host key
+// against its project's known_hosts. Keys from terraform output are seeded
+// first and must match; otherwise the key is pinned on first use. A changed
+// key fails the connection either way.
+func hostKeyOptions(inst *InstanceInfo) ([]sshOption, error) {
+	if err := SeedHostKey(inst); err != nil {
+		return nil, err
+	}
+
+	knownHosts, err := GetKnownHostsPath(inst.ProjectName)
+	if err != nil {
+		return nil, err
+	}
+	if err := EnsureDir(filepath.Dir(knownHosts)); err != nil {
+		return nil, err
+	}
+
+	strict := "accept-new"
+	if inst.HostKey != "" {
+		strict = "yes"
+	}
+	return []sshOption{
+		{Key: "StrictHostKeyChecking", Value: strict},
+		{Key: "UserKnownHostsFile", Value: knownHosts},
+		{Key: "HostKeyAlias", Value: HostKeyAlias(inst)},
+	}, nil
+}
@@ -0,0 +1,88 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIX5DeLqDMvHMTzGcmn9z0sfPlsgReC/kJEF46RtSDCJ"
+
+func TestHostKeyEntryFingerprint(t *testing.T) {
+	entry, err := parseHostKey("prod/web-1", testHostKey+" root@vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := entry.Fingerprint(), "SHA256:Y8F5z829W9u+aiSODkGbj9nRIS7m5S01rJLZ60jSKxY"; got != want {
+		t.Errorf("Fingerprint() = %q, want %q", got, want)
+	}
+	if !entry.FromTerraform() {
+		t.Error("FromTerraform() = false for a seeded key")
+	}
+
+	if _, err := parseHostKey("prod/web-1", "ssh-ed25519"); err == nil {
+		t.Error("parseHostKey() accepted a key without data")
+	}
+}
+
+func TestSeedHostKey(t *testing.T) {
+	setupWorkspace(t)
+	path, err := GetKnownHostsPath("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+	// Keys pinned on first use by ssh
+	pinned := "prod/db-1 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDb\nprod/web-1 ssh-rsa AAAAB3NzaC1yc2E=\n"
+	if err := os.WriteFile(path, []byte(pinned), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	web := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.1", HostKey: testHostKey}
+	if err := SeedHostKey(web); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadKnownHosts("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.String())
+	}
+	want := []string{"prod/db-1 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDb", "prod/web-1 " + testHostKey + " inframan:terraform"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("known_hosts = %q, want %q", got, want)
+	}
+
+	// Instances without a host key are pinned on first use
+	args, err := hostKeyOptions(&InstanceInfo{ProjectName: "prod", InstanceName: "db-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(optionArgs(args), " "); got != "-o StrictHostKeyChecking=accept-new -o UserKnownHostsFile="+path+" -o HostKeyAlias=prod/db-1" {
+		t.Errorf("hostKeyOptions() = %q", got)
+	}
+	args, err = hostKeyOptions(web)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(strings.Join(optionArgs(args), " "), "-o StrictHostKeyChecking=yes ") {
+		t.Errorf("hostKeyOptions() with host key = %q", args)
+	}
+
+	removed, err := RemoveHostKeys("prod", func(host string) bool { return host == "prod/db-1" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Host != "prod/db-1" {
+		t.Errorf("RemoveHostKeys() = %v", removed)
+	}
+	if entries, _ := ReadKnownHosts("prod"); len(entries) != 1 {
+		t.Errorf("known_hosts has %d entries after removal, want 1", len(entries))
+	}
+}
@@ -0,0 +1,333 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	// LockFileName is the advisory lock file in .inframan/<project>/
+	LockFileName = "inframan.lock"
+
+	// StaleLockAge is the age after which a lock held from another host is
+	// considered stale. Locks from this host are stale as soon as their
+	// process exits.
+	StaleLockAge = 24 * time.Hour
+
+	// lockPollInterval is how often a waiting command retries the lock
+	lockPollInterval = 2 * time.Second
+
+	// lockWriteGrace is how long an empty or unparsable lock file counts as
+	// held, as its holder may still be writing it. Older ones are stale,
+	// left by a process that crashed while taking the lock.
+	lockWriteGrace = 10 * time.Second
+)
+
+// LockInfo describes who holds a project lock
+type LockInfo struct {
+	Owner     string    `json:"owner"`
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// String describes the lock holder for error messages
+func (l *LockInfo) String() string {
+	return fmt.Sprintf("%s@%s (pid %d) running %q since %s", l.Owner, l.Host, l.PID, l.Command, l.StartedAt.Local().Format("2006-01-02 15:04:05"))
+}
+
+// IsStale reports whether the process holding the lock is gone
+func (l *LockInfo) IsStale() bool {
+	host, _ := os.Hostname()
+	if l.Host != host {
+		return time.Since(l.StartedAt) > StaleLockAge
+	}
+	return !processExists(l.PID)
+}
+
+// processExists reports whether a process with the given PID is running on this host
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Lock is a held project lock
+type Lock struct {
+	path string
+	info *LockInfo
+}
+
+// GetLockPath returns the lock file path of a project
+func GetLockPath(projectName string) (string, error) {
+	inframanDir, err := GetInframanDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(inframanDir, projectName, LockFileName), nil
+}
+
+// currentLockInfo describes this process as a lock holder
+func currentLockInfo(command string) *LockInfo {
+	host, _ := os.Hostname()
+	return &LockInfo{
+		Owner:     currentUser(),
+		PID:       os.Getpid(),
+		Host:      host,
+		Command:   command,
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+// currentUser returns the name of the user running inframan
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// lockFile is a lock file as read from disk
+type lockFile struct {
+	data    []byte
+	modTime time.Time
+
+	// holder is nil if the file is empty or cannot be parsed
+	holder   *LockInfo
+	parseErr error
+}
+
+// readLockFile reads a lock file, or returns nil if it does not exist
+func readLockFile(lockPath string) (*lockFile, error) {
+	f, err := os.Open(lockPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	lf := &lockFile{data: data, modTime: stat.ModTime()}
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		lf.parseErr = fmt.Errorf("failed to parse lock file %s: %w", lockPath, err)
+	} else {
+		lf.holder = &info
+	}
+	return lf, nil
+}
+
+// isStale reports whether the lock may be removed: its holder is gone, or
+// it is unparsable and older than lockWriteGrace
+func (f *lockFile) isStale() bool {
+	if f.holder == nil {
+		return time.Since(f.modTime) > lockWriteGrace
+	}
+	return f.holder.IsStale()
+}
+
+// String describes the lock holder for messages
+func (f *lockFile) String() string {
+	if f.holder == nil {
+		return "an unreadable lock file"
+	}
+	return f.holder.String()
+}
+
+// removeStaleLock removes a lock file judged stale from its content seen.
+// The file is renamed aside first, so that of several processes removing
+// the same stale lock only one gets it. If the file was replaced with a new
+// lock in the meantime, that lock is put back.
+func removeStaleLock(lockPath string, seen *lockFile) error {
+	aside := fmt.Sprintf("%s.stale-%d", lockPath, os.Getpid())
+	if err := os.Rename(lockPath, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove stale lock: %w", err)
+	}
+	defer os.Remove(aside)
+
+	data, err := os.ReadFile(aside)
+	if err != nil {
+		return fmt.Errorf("failed to remove stale lock: %w", err)
+	}
+	if !bytes.Equal(data, seen.data) {
+		return restoreLock(aside, lockPath, data)
+	}
+	return nil
+}
+
+// restoreLock puts back a live lock, with content data, that was renamed
+// aside. It links rather than renames, so a lock taken since is not
+// overwritten; if one was, both runs may hold the project and it fails.
+func restoreLock(aside, lockPath string, data []byte) error {
+	err := os.Link(aside, lockPath)
+	if err == nil {
+		return nil
+	}
+	if !os.IsExist(err) {
+		return fmt.Errorf("failed to restore lock file: %w", err)
+	}
+
+	current, err := os.ReadFile(lockPath)
+	if err != nil {
+		return fmt.Errorf("failed to restore lock file: %w", err)
+	}
+	if bytes.Equal(current, data) {
+		return nil
+	}
+
+	holder := "an unreadable lock file"
+	var info LockInfo
+	if json.Unmarshal(data, &info) == nil {
+		holder = info.String()
+	}
+	return fmt.Errorf("failed to restore lock file: the lock held by %s was replaced by a new lock while a stale lock was removed; make sure only one run is active", holder)
+}
+
+// AcquireLock takes the advisory lock of a project. Stale locks are removed.
+// If the project is locked, AcquireLock retries until wait elapses; a zero
+// wait fails immediately.
+func AcquireLock(projectName, command string, wait time.Duration) (*Lock, error) {
+	lockPath, err := GetLockPath(projectName)
+	if err != nil {
+		return nil, err
+	}
+	if err := EnsureDir(filepath.Dir(lockPath)); err != nil {
+		return nil, err
+	}
+
+	info := currentLockInfo(command)
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lock: %w", err)
+	}
+
+	deadline := time.Now().Add(wait)
+	waiting := false
+	for {
+		f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, werr := f.Write(data)
+			if cerr := f.Close(); werr == nil {
+				werr = cerr
+			}
+			if werr != nil {
+				os.Remove(lockPath)
+				return nil, fmt.Errorf("failed to write lock file: %w", werr)
+			}
+			return &Lock{path: lockPath, info: info}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		held, err := readLockFile(lockPath)
+		if err != nil {
+			return nil, err
+		}
+		if held == nil {
+			// Released between our attempts
+			continue
+		}
+		if held.isStale() {
+			fmt.Fprintf(os.Stderr, "Removing stale lock held by %s\n", held)
+			if err := removeStaleLock(lockPath, held); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if time.Now().Add(lockPollInterval).After(deadline) {
+			return nil, fmt.Errorf("project %q is locked by %s; use --wait to wait for it, or 'inframan unlock %s' if it is abandoned", projectName, held, projectName)
+		}
+		if !waiting {
+			fmt.Fprintf(os.Stderr, "Waiting for lock on project %q held by %s...\n", projectName, held)
+			waiting = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// ReadLock returns the current holder of a project lock, or nil if the project is not locked
+func ReadLock(projectName string) (*LockInfo, error) {
+	lockPath, err := GetLockPath(projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	held, err := readLockFile(lockPath)
+	if err != nil || held == nil {
+		return nil, err
+	}
+	if held.parseErr != nil {
+		return nil, held.parseErr
+	}
+	return held.holder, nil
+}
+
+// ForceUnlock removes a project lock regardless of its holder, even if the
+// lock file cannot be parsed. It reports whether a lock was removed and its
+// holder, which is nil for an unparsable lock file.
+func ForceUnlock(projectName string) (*LockInfo, bool, error) {
+	lockPath, err := GetLockPath(projectName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	held, err := readLockFile(lockPath)
+	if err != nil || held == nil {
+		return nil, false, err
+	}
+	if err := os.Remove(lockPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return held.holder, true, nil
+}
+
+// Release removes the lock file if it is still held by this process
+func (l *Lock) Release() error {
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	var holder LockInfo
+	if err := json.Unmarshal(data, &holder); err != nil || holder.PID != l.info.PID || holder.Host != l.info.Host {
+		// Someone force-unlocked and re-locked the project; leave their lock alone
+		return nil
+	}
+
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return nil
+}
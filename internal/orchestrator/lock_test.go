@@ -0,0 +1,249 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	setupWorkspace(t)
+
+	lock, err := AcquireLock("prod", "infra", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	holder, err := ReadLock("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder == nil || holder.PID != os.Getpid() || holder.Command != "infra" {
+		t.Fatalf("holder = %+v, want this process running infra", holder)
+	}
+
+	// A second run on the same project is refused
+	_, err = AcquireLock("prod", "deploy", 0)
+	if err == nil || !strings.Contains(err.Error(), `project "prod" is locked`) {
+		t.Fatalf("error = %v, want project locked", err)
+	}
+
+	// Other projects are independent
+	other, err := AcquireLock("staging", "deploy", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := other.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if holder, _ := ReadLock("prod"); holder != nil {
+		t.Errorf("lock still held after release: %+v", holder)
+	}
+}
+
+func TestAcquireLockRemovesStaleLock(t *testing.T) {
+	setupWorkspace(t)
+
+	// A lock from this host whose process no longer exists
+	stale := currentLockInfo("deploy")
+	stale.PID = 1 << 30
+	writeLock(t, "prod", stale)
+
+	lock, err := AcquireLock("prod", "infra", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lock.Release()
+
+	holder, err := ReadLock("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder.PID != os.Getpid() {
+		t.Errorf("holder PID = %d, want %d", holder.PID, os.Getpid())
+	}
+}
+
+func TestLockStaleness(t *testing.T) {
+	host, _ := os.Hostname()
+
+	tests := []struct {
+		name string
+		info LockInfo
+		want bool
+	}{
+		{name: "running process", info: LockInfo{Host: host, PID: os.Getpid(), StartedAt: time.Now()}, want: false},
+		{name: "exited process", info: LockInfo{Host: host, PID: 1 << 30, StartedAt: time.Now()}, want: true},
+		{name: "recent lock on other host", info: LockInfo{Host: host + "-other", PID: 1, StartedAt: time.Now()}, want: false},
+		{name: "old lock on other host", info: LockInfo{Host: host + "-other", PID: 1, StartedAt: time.Now().Add(-StaleLockAge - time.Hour)}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.IsStale(); got != tt.want {
+				t.Errorf("IsStale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	setupWorkspace(t)
+
+	if holder, removed, err := ForceUnlock("prod"); err != nil || removed || holder != nil {
+		t.Fatalf("ForceUnlock() = %v, %v, %v; want nothing removed for unlocked project", holder, removed, err)
+	}
+
+	lock, err := AcquireLock("prod", "infra", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holder, removed, err := ForceUnlock("prod")
+	if err != nil || !removed {
+		t.Fatalf("ForceUnlock() = %v, %v; want lock removed", removed, err)
+	}
+	if holder == nil || holder.Command != "infra" {
+		t.Errorf("holder = %+v, want infra lock", holder)
+	}
+
+	// Releasing after a forced unlock leaves a newer lock alone
+	newer := currentLockInfo("deploy")
+	newer.PID = os.Getpid() + 1
+	writeLock(t, "prod", newer)
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if holder, _ := ReadLock("prod"); holder == nil || holder.Command != "deploy" {
+		t.Errorf("holder = %+v, want newer deploy lock kept", holder)
+	}
+}
+
+func TestUnreadableLock(t *testing.T) {
+	setupWorkspace(t)
+	lockPath, err := GetLockPath("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty lock file may still be being written by its holder
+	if err := os.WriteFile(lockPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireLock("prod", "infra", 0); err == nil || !strings.Contains(err.Error(), "locked by an unreadable lock file") {
+		t.Fatalf("AcquireLock() error = %v, want locked", err)
+	}
+
+	// Past the grace period, it was left by a crash and is removed
+	old := time.Now().Add(-2 * lockWriteGrace)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := AcquireLock("prod", "infra", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lock.Release()
+
+	// unlock removes an unparsable lock file
+	if err := os.WriteFile(lockPath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	holder, removed, err := ForceUnlock("prod")
+	if err != nil || !removed || holder != nil {
+		t.Fatalf("ForceUnlock() = %v, %v, %v; want unparsable lock removed", holder, removed, err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists: %v", err)
+	}
+}
+
+func TestRemoveStaleLockKeepsNewerLock(t *testing.T) {
+	setupWorkspace(t)
+
+	stale := currentLockInfo("deploy")
+	stale.PID = 1 << 30
+	writeLock(t, "prod", stale)
+	lockPath, err := GetLockPath("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen, err := readLockFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process removed the stale lock and took the project
+	newer := currentLockInfo("infra")
+	writeLock(t, "prod", newer)
+
+	if err := removeStaleLock(lockPath, seen); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if holder, _ := ReadLock("prod"); holder == nil || holder.Command != "infra" {
+		t.Errorf("holder = %+v, want the newer infra lock kept", holder)
+	}
+}
+
+func TestRestoreLockConflict(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, LockFileName)
+	aside := lockPath + ".stale-1"
+
+	live, err := json.Marshal(currentLockInfo("deploy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(aside, live, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing took the project: the live lock is put back
+	if err := restoreLock(aside, lockPath, live); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Another run took the project between the rename and the link
+	if err := os.Remove(lockPath); err != nil {
+		t.Fatal(err)
+	}
+	newer, err := json.Marshal(currentLockInfo("infra"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockPath, newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreLock(aside, lockPath, live); err == nil || !strings.Contains(err.Error(), "replaced by a new lock") {
+		t.Fatalf("restoreLock() error = %v, want a conflict", err)
+	}
+}
+
+// writeLock writes a lock file for a project
+func writeLock(t *testing.T, projectName string, info *LockInfo) {
+	t.Helper()
+	lockPath, err := GetLockPath(projectName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureDir(strings.TrimSuffix(lockPath, LockFileName)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
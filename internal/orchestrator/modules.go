@@ -0,0 +1,164 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// CommonModuleFileName is the module imported by every node in a module directory
+	CommonModuleFileName = "common.nix"
+
+	// DefaultModuleFileName is the fallback module for nodes without their own file in a module directory
+	DefaultModuleFileName = "default.nix"
+)
+
+// MachineModules maps instances to the NixOS modules they import.
+// Every node imports the Common modules plus either its own module from
+// Instances or, if it has none, the Default module.
+type MachineModules struct {
+	Default   string            `json:"default,omitempty"`
+	Common    []string          `json:"common,omitempty"`
+	Instances map[string]string `json:"instances,omitempty"`
+}
+
+// LoadMachineModules resolves NIXOS_MODULE_PATH into a module mapping. The path can be:
+//   - a single .nix file, applied to every instance
+//   - a directory of <instance>.nix files, with optional common.nix and default.nix
+//   - a .json file: {"default": "...", "common": ["..."], "instances": {"web-1": "..."}}
+//
+// Relative paths in a JSON mapping are resolved against the JSON file's directory.
+func LoadMachineModules(path string) (*MachineModules, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat module path: %w", err)
+	}
+
+	var modules *MachineModules
+	switch {
+	case info.IsDir():
+		modules, err = loadModuleDir(path)
+	case strings.HasSuffix(path, ".json"):
+		modules, err = loadModuleJSON(path)
+	default:
+		modules = &MachineModules{Default: path}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Nix needs absolute paths to import modules from the generated hive
+	if err := modules.makeAbs(); err != nil {
+		return nil, err
+	}
+
+	return modules, nil
+}
+
+// loadModuleDir builds a mapping from a directory of <instance>.nix files
+func loadModuleDir(dir string) (*MachineModules, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module directory: %w", err)
+	}
+
+	modules := &MachineModules{Instances: map[string]string{}}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".nix") {
+			continue
+		}
+
+		modulePath := filepath.Join(dir, entry.Name())
+		switch entry.Name() {
+		case CommonModuleFileName:
+			modules.Common = append(modules.Common, modulePath)
+		case DefaultModuleFileName:
+			modules.Default = modulePath
+		default:
+			modules.Instances[strings.TrimSuffix(entry.Name(), ".nix")] = modulePath
+		}
+	}
+
+	return modules, nil
+}
+
+// loadModuleJSON reads a mapping from a JSON file
+func loadModuleJSON(path string) (*MachineModules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module mapping: %w", err)
+	}
+
+	var modules MachineModules
+	if err := json.Unmarshal(data, &modules); err != nil {
+		return nil, fmt.Errorf("failed to parse module mapping %s: %w", path, err)
+	}
+
+	// Resolve relative paths against the mapping file
+	baseDir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(baseDir, p)
+	}
+	modules.Default = resolve(modules.Default)
+	for i, p := range modules.Common {
+		modules.Common[i] = resolve(p)
+	}
+	for name, p := range modules.Instances {
+		modules.Instances[name] = resolve(p)
+	}
+
+	return &modules, nil
+}
+
+// makeAbs converts every module path to an absolute path
+func (m *MachineModules) makeAbs() error {
+	abs := func(p string) (string, error) {
+		if p == "" {
+			return "", nil
+		}
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			return "", fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		return absPath, nil
+	}
+
+	var err error
+	if m.Default, err = abs(m.Default); err != nil {
+		return err
+	}
+	for i, p := range m.Common {
+		if m.Common[i], err = abs(p); err != nil {
+			return err
+		}
+	}
+	for name, p := range m.Instances {
+		if m.Instances[name], err = abs(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ModulesFor returns the modules a node imports: the common modules followed
+// by the instance's own module or the default module. An instance with
+// neither is an error even if there are common modules, so that a forgotten
+// <instance>.nix does not deploy a bare system.
+func (m *MachineModules) ModulesFor(inst *InstanceInfo) ([]string, error) {
+	modules := append([]string{}, m.Common...)
+
+	if modulePath, ok := m.Instances[inst.InstanceName]; ok && inst.InstanceName != "" {
+		return append(modules, modulePath), nil
+	}
+	if m.Default != "" {
+		return append(modules, m.Default), nil
+	}
+
+	return nil, fmt.Errorf("no machine module for instance %s (expected %s.nix or a default module)", inst.FullName(), inst.NodeName())
+}
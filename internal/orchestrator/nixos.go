@@ -0,0 +1,123 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CurrentSystemPath is the symlink to the active NixOS system on a host
+	CurrentSystemPath = "/run/current-system"
+
+	// SystemProfile is the Nix profile holding a host's system generations
+	SystemProfile = "/nix/var/nix/profiles/system"
+)
+
+// GetCurrentSystem returns the store path of the system currently active on an instance
+func GetCurrentSystem(inst *InstanceInfo, opts SSHOptions) (string, error) {
+	output, err := RunRemote(inst, opts, "readlink -f "+CurrentSystemPath)
+	if err != nil {
+		return "", err
+	}
+
+	current := strings.TrimSpace(output)
+	if !strings.HasPrefix(current, "/nix/store/") {
+		return "", fmt.Errorf("unexpected %s on %s: %q", CurrentSystemPath, inst.FullName(), current)
+	}
+	return current, nil
+}
+
+// Generation is a NixOS system generation on a host
+type Generation struct {
+	Number  int
+	Created string // as reported by nix-env, in the host's local time
+	Current bool
+}
+
+// ListGenerations returns the system generations of an instance, oldest first
+func ListGenerations(inst *InstanceInfo, opts SSHOptions) ([]*Generation, error) {
+	output, err := RunRemote(inst, opts, "nix-env --list-generations -p "+SystemProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	generations, err := parseGenerations(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generations of %s: %w", inst.FullName(), err)
+	}
+	return generations, nil
+}
+
+// parseGenerations parses the output of nix-env --list-generations, e.g.
+//
+//	41   2024-03-01 10:12:45
+//	42   2024-03-08 16:03:10   (current)
+func parseGenerations(output string) ([]*Generation, error) {
+	var generations []*Generation
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected line %q", line)
+		}
+
+		number, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected line %q", line)
+		}
+		generations = append(generations, &Generation{
+			Number:  number,
+			Created: fields[1] + " " + fields[2],
+			Current: len(fields) > 3 && fields[3] == "(current)",
+		})
+	}
+	return generations, nil
+}
+
+// PreviousGeneration returns the generation before the current one, as
+// nixos-rebuild --rollback would activate, or nil if there is none
+func PreviousGeneration(generations []*Generation) *Generation {
+	for i, gen := range generations {
+		if gen.Current {
+			if i == 0 {
+				return nil
+			}
+			return generations[i-1]
+		}
+	}
+	return nil
+}
+
+// CurrentGeneration returns the number of the system generation currently
+// active on an instance
+func CurrentGeneration(inst *InstanceInfo, opts SSHOptions) (int, error) {
+	generations, err := ListGenerations(inst, opts)
+	if err != nil {
+		return 0, err
+	}
+	for _, gen := range generations {
+		if gen.Current {
+			return gen.Number, nil
+		}
+	}
+	return 0, fmt.Errorf("no current generation on %s", inst.FullName())
+}
+
+// SwitchGeneration makes a system generation the current one on an instance
+// and activates it. Commands are run with sudo unless connecting as root.
+func SwitchGeneration(inst *InstanceInfo, opts SSHOptions, number int) error {
+	sudo := ""
+	if opts.user(inst) != "root" {
+		sudo = "sudo "
+	}
+
+	command := fmt.Sprintf("%snix-env -p %s --switch-generation %d && %s%s/bin/switch-to-configuration switch",
+		sudo, SystemProfile, number, sudo, SystemProfile)
+	if _, err := RunRemote(inst, opts, command); err != nil {
+		return fmt.Errorf("failed to activate generation %d on %s: %w", number, inst.FullName(), err)
+	}
+	return nil
+}
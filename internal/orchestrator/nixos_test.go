@@ -0,0 +1,70 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+)
+
+const generationsOutput = `  40   2024-02-20 09:01:12
+  41   2024-03-01 10:12:45
+  42   2024-03-08 16:03:10   (current)
+`
+
+func TestParseGenerations(t *testing.T) {
+	generations, err := parseGenerations(generationsOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(generations) != 3 {
+		t.Fatalf("got %d generations, want 3", len(generations))
+	}
+
+	last := generations[2]
+	if last.Number != 42 || last.Created != "2024-03-08 16:03:10" || !last.Current {
+		t.Errorf("last generation = %+v", last)
+	}
+	if generations[0].Current {
+		t.Errorf("generation 40 should not be current")
+	}
+
+	if previous := PreviousGeneration(generations); previous == nil || previous.Number != 41 {
+		t.Errorf("PreviousGeneration() = %+v, want 41", previous)
+	}
+	if previous := PreviousGeneration(generations[2:]); previous != nil {
+		t.Errorf("PreviousGeneration() = %+v, want nil", previous)
+	}
+
+	if _, err := parseGenerations("error: no profile\n"); err == nil {
+		t.Error("expected error for unexpected output")
+	}
+}
+
+func TestSwitchGeneration(t *testing.T) {
+	inst := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.1"}
+
+	tests := []struct {
+		name string
+		user string
+		want string
+	}{
+		{name: "root", user: "root", want: "nix-env -p /nix/var/nix/profiles/system --switch-generation 41 && /nix/var/nix/profiles/system/bin/switch-to-configuration switch"},
+		{name: "sudo", user: "nixos", want: "sudo nix-env -p /nix/var/nix/profiles/system --switch-generation 41 && sudo /nix/var/nix/profiles/system/bin/switch-to-configuration switch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupWorkspace(t)
+
+			if err := SwitchGeneration(inst, SSHOptions{User: tt.user}, 41); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			args := fake.Calls()[0].Args
+			if got := args[len(args)-1]; got != tt.want {
+				t.Errorf("remote command = %q, want %q", got, tt.want)
+			}
+			if got := args[len(args)-2]; !strings.HasPrefix(got, tt.user+"@") {
+				t.Errorf("destination = %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Package orchestratortest provides a fake Runner for tests of the
+// orchestrator and the commands built on it.
+package orchestratortest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/iivel-inc/inframan/internal/runner"
+)
+
+// FakeResponse is the canned result of a command run by FakeRunner
+type FakeResponse struct {
+	Stdout   string
+	ExitCode int
+	Err      error
+}
+
+// FakeExitError is returned by FakeRunner for non-zero exit codes
+type FakeExitError struct {
+	Code int
+}
+
+// Error implements error
+func (e *FakeExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the fake exit code
+func (e *FakeExitError) ExitCode() int {
+	return e.Code
+}
+
+// FakeRunner records commands instead of running them and answers with
+// canned responses. Responses are matched by the longest registered prefix
+// of the command line; unmatched commands succeed with no output.
+type FakeRunner struct {
+	mu        sync.Mutex
+	calls     []*runner.Command
+	responses map[string]FakeResponse
+}
+
+// NewFakeRunner creates a fake runner with no canned responses
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{responses: map[string]FakeResponse{}}
+}
+
+// On registers the response for commands starting with prefix, e.g. "terraform output"
+func (f *FakeRunner) On(prefix string, resp FakeResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[prefix] = resp
+}
+
+// Calls returns the commands run so far
+func (f *FakeRunner) Calls() []*runner.Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*runner.Command{}, f.calls...)
+}
+
+// CommandLines returns the command lines run so far
+func (f *FakeRunner) CommandLines() []string {
+	calls := f.Calls()
+	lines := make([]string, len(calls))
+	for i, c := range calls {
+		lines[i] = c.String()
+	}
+	return lines
+}
+
+// respond records the command and looks up its response
+func (f *FakeRunner) respond(c *runner.Command) (FakeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, c)
+
+	line := c.String()
+	var best string
+	var resp FakeResponse
+	for prefix, r := range f.responses {
+		if strings.HasPrefix(line, prefix) && len(prefix) >= len(best) {
+			best, resp = prefix, r
+		}
+	}
+
+	if resp.Err != nil {
+		return resp, resp.Err
+	}
+	if resp.ExitCode != 0 {
+		return resp, &FakeExitError{Code: resp.ExitCode}
+	}
+	return resp, nil
+}
+
+// Run records the command and writes the canned stdout to its Stdout
+func (f *FakeRunner) Run(c *runner.Command) error {
+	resp, err := f.respond(c)
+	if c.Stdout != nil && resp.Stdout != "" {
+		if _, werr := c.Stdout.Write([]byte(resp.Stdout)); werr != nil {
+			return werr
+		}
+	}
+	return err
+}
+
+// Output records the command and returns the canned stdout
+func (f *FakeRunner) Output(c *runner.Command) ([]byte, error) {
+	resp, err := f.respond(c)
+	return []byte(resp.Stdout), err
+}
+
+// Exec records the command instead of replacing the process
+func (f *FakeRunner) Exec(c *runner.Command) error {
+	_, err := f.respond(c)
+	return err
+}
@@ -0,0 +1,173 @@
+package orchestrator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// PlanFileName is the default name of the saved terraform plan
+	PlanFileName = "inframan.tfplan"
+
+	// driftPlanFileName is the temporary refresh-only plan used by drift detection
+	driftPlanFileName = "inframan-drift.tfplan"
+
+	// autoPlanFileName is the temporary plan used by non-interactive applies
+	autoPlanFileName = "inframan-auto.tfplan"
+
+	// planMetaSuffix is appended to the plan file name for its metadata file
+	planMetaSuffix = ".meta.json"
+)
+
+// PlanMeta records what a saved plan was created from
+type PlanMeta struct {
+	ConfigHash string    `json:"config_hash"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ResourceChange is a single resource change in a terraform plan
+type ResourceChange struct {
+	Address string   `json:"address"`
+	Actions []string `json:"actions"`
+}
+
+// Action returns a short description of the change: create, update, delete, replace or no-op
+func (r *ResourceChange) Action() string {
+	switch {
+	case hasAction(r.Actions, "create") && hasAction(r.Actions, "delete"):
+		return "replace"
+	case hasAction(r.Actions, "create"):
+		return "create"
+	case hasAction(r.Actions, "delete"):
+		return "delete"
+	case hasAction(r.Actions, "update"):
+		return "update"
+	default:
+		return "no-op"
+	}
+}
+
+// PlanSummary is a summary of the changes in a terraform plan
+type PlanSummary struct {
+	Add     int               `json:"add"`
+	Change  int               `json:"change"`
+	Destroy int               `json:"destroy"`
+	Changes []*ResourceChange `json:"changes"`
+
+	// Drift lists resources changed outside of terraform, detected while refreshing
+	Drift []*ResourceChange `json:"drift,omitempty"`
+}
+
+// HasChanges reports whether the plan changes any resource
+func (p *PlanSummary) HasChanges() bool {
+	return p.Add+p.Change+p.Destroy > 0
+}
+
+// planResourceJSON is a resource change or drift entry in `terraform show -json <plan>`
+type planResourceJSON struct {
+	Address string `json:"address"`
+	Change  struct {
+		Actions []string `json:"actions"`
+	} `json:"change"`
+}
+
+// planJSON is the subset of `terraform show -json <plan>` we care about
+type planJSON struct {
+	ResourceChanges []planResourceJSON `json:"resource_changes"`
+	ResourceDrift   []planResourceJSON `json:"resource_drift"`
+}
+
+// ParsePlanJSON summarizes the output of `terraform show -json <plan>`.
+// Replacements count as both an add and a destroy, like terraform's own summary.
+func ParsePlanJSON(data []byte) (*PlanSummary, error) {
+	var plan planJSON
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+
+	summary := &PlanSummary{}
+	for _, rc := range plan.ResourceChanges {
+		change := &ResourceChange{Address: rc.Address, Actions: rc.Change.Actions}
+		switch change.Action() {
+		case "create":
+			summary.Add++
+		case "delete":
+			summary.Destroy++
+		case "update":
+			summary.Change++
+		case "replace":
+			summary.Add++
+			summary.Destroy++
+		default:
+			continue
+		}
+		summary.Changes = append(summary.Changes, change)
+	}
+
+	for _, rd := range plan.ResourceDrift {
+		summary.Drift = append(summary.Drift, &ResourceChange{Address: rd.Address, Actions: rd.Change.Actions})
+	}
+
+	sortChanges(summary.Changes)
+	sortChanges(summary.Drift)
+
+	return summary, nil
+}
+
+// sortChanges sorts resource changes by address
+func sortChanges(changes []*ResourceChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Address < changes[j].Address
+	})
+}
+
+// hasAction reports whether actions contains action
+func hasAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// HashFile returns the hex-encoded SHA-256 of a file's contents
+func HashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// WritePlanMeta records the config hash a plan was created from
+func WritePlanMeta(planPath, configHash string) error {
+	data, err := json.MarshalIndent(&PlanMeta{ConfigHash: configHash, CreatedAt: time.Now().UTC()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan metadata: %w", err)
+	}
+	if err := os.WriteFile(planPath+planMetaSuffix, data, 0644); err != nil {
+		return fmt.Errorf("failed to write plan metadata: %w", err)
+	}
+	return nil
+}
+
+// ReadPlanMeta reads the metadata recorded for a saved plan
+func ReadPlanMeta(planPath string) (*PlanMeta, error) {
+	data, err := os.ReadFile(planPath + planMetaSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan metadata (was the plan created by 'inframan plan'?): %w", err)
+	}
+
+	var meta PlanMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse plan metadata: %w", err)
+	}
+	return &meta, nil
+}
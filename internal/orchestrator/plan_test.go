@@ -0,0 +1,58 @@
+package orchestrator
+
+import (
+	"testing"
+)
+
+func TestParsePlanJSON(t *testing.T) {
+	data := []byte(`{
+  "resource_changes": [
+    {"address": "aws_instance.web", "change": {"actions": ["update"]}},
+    {"address": "aws_instance.db", "change": {"actions": ["delete", "create"]}},
+    {"address": "aws_key_pair.deployer", "change": {"actions": ["no-op"]}},
+    {"address": "aws_eip.web", "change": {"actions": ["create"]}},
+    {"address": "aws_s3_bucket.old", "change": {"actions": ["delete"]}}
+  ],
+  "resource_drift": [
+    {"address": "aws_security_group.main", "change": {"actions": ["update"]}}
+  ]
+}`)
+
+	summary, err := ParsePlanJSON(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if summary.Add != 2 || summary.Change != 1 || summary.Destroy != 2 {
+		t.Errorf("summary = %d add, %d change, %d destroy; want 2, 1, 2", summary.Add, summary.Change, summary.Destroy)
+	}
+
+	want := []string{
+		"create aws_eip.web",
+		"replace aws_instance.db",
+		"update aws_instance.web",
+		"delete aws_s3_bucket.old",
+	}
+	if len(summary.Changes) != len(want) {
+		t.Fatalf("changes = %d, want %d", len(summary.Changes), len(want))
+	}
+	for i, c := range summary.Changes {
+		if got := c.Action() + " " + c.Address; got != want[i] {
+			t.Errorf("change %d = %q, want %q", i, got, want[i])
+		}
+	}
+
+	if len(summary.Drift) != 1 || summary.Drift[0].Address != "aws_security_group.main" {
+		t.Errorf("drift = %+v, want aws_security_group.main", summary.Drift)
+	}
+}
+
+func TestParsePlanJSONNoChanges(t *testing.T) {
+	summary, err := ParsePlanJSON([]byte(`{"resource_changes": [{"address": "a.b", "change": {"actions": ["no-op"]}}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary.HasChanges() {
+		t.Errorf("HasChanges() = true, want false")
+	}
+}
@@ -0,0 +1,270 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ProjectFileName is the name of the project config file, discovered
+	// upward from the working directory
+	ProjectFileName = "inframan.json"
+)
+
+// Hook stages run around commands
+const (
+	HookPreInfra    = "pre_infra"
+	HookPostInfra   = "post_infra"
+	HookPreDeploy   = "pre_deploy"
+	HookPostDeploy  = "post_deploy"
+	HookPreDestroy  = "pre_destroy"
+	HookPostDestroy = "post_destroy"
+)
+
+// ProjectFile is the inframan.json project config file
+type ProjectFile struct {
+	// DefaultProject is used when neither --project nor PROJECT_NAME is set
+	DefaultProject string `json:"default_project,omitempty"`
+
+	// Projects maps project names to their settings
+	Projects map[string]*ProjectConfig `json:"projects"`
+
+	// path is where the file was loaded from
+	path string
+}
+
+// ProjectConfig holds the settings of one project in inframan.json.
+// Relative paths are resolved against the directory of inframan.json.
+type ProjectConfig struct {
+	InfraConfig    string              `json:"infra_config,omitempty"`
+	MachineModules string              `json:"machine_modules,omitempty"`
+	Engine         string              `json:"engine,omitempty"`
+	EnginePath     string              `json:"engine_path,omitempty"`
+	SSH            SSHConfig           `json:"ssh,omitempty"`
+	Hooks          map[string][]string `json:"hooks,omitempty"`
+	HealthChecks   []HealthCheck       `json:"health_checks,omitempty"`
+}
+
+// SSHConfig holds the SSH settings of a project
+type SSHConfig struct {
+	User       string `json:"user,omitempty"`
+	KeyPath    string `json:"key_path,omitempty"`
+	ConfigPath string `json:"config_path,omitempty"`
+
+	// Bastion is the jump host of the project's instances: [user@]host[:port]
+	// or an instance selector such as "network/bastion"
+	Bastion string `json:"bastion,omitempty"`
+}
+
+// projectFilePath is set by the --config flag
+var projectFilePath string
+
+// SetProjectFilePath overrides discovery of inframan.json
+func SetProjectFilePath(path string) {
+	projectFilePath = path
+}
+
+// FindProjectFile returns the path of inframan.json: the --config flag,
+// INFRAMAN_CONFIG, or the first inframan.json found walking up from the
+// workspace root if it is set with --workspace or INFRAMAN_ROOT, else from
+// the working directory. It returns an empty string if there is none.
+func FindProjectFile() (string, error) {
+	if projectFilePath != "" {
+		return projectFilePath, nil
+	}
+	if path := os.Getenv("INFRAMAN_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+	// An explicit workspace root also selects its project file, so that
+	// inframan.json and .inframan/ come from the same tree
+	if firstNonEmpty(workspaceRootOverride, os.Getenv("INFRAMAN_ROOT")) != "" {
+		if dir, err = GetWorkspaceRoot(); err != nil {
+			return "", err
+		}
+	}
+	for {
+		candidate := filepath.Join(dir, ProjectFileName)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectFile finds and parses inframan.json. It returns an empty
+// project file if none exists.
+func LoadProjectFile() (*ProjectFile, error) {
+	path, err := FindProjectFile()
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return &ProjectFile{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project file: %w", err)
+	}
+
+	var file ProjectFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse project file %s: %w", path, err)
+	}
+	file.path = path
+
+	for name, project := range file.Projects {
+		if project == nil {
+			return nil, fmt.Errorf("project %q in %s has no settings", name, path)
+		}
+		for stage := range project.Hooks {
+			if !isHookStage(stage) {
+				return nil, fmt.Errorf("project %q in %s has unknown hook stage %q", name, path, stage)
+			}
+		}
+		for i := range project.HealthChecks {
+			if err := project.HealthChecks[i].Validate(); err != nil {
+				return nil, fmt.Errorf("project %q in %s: %w", name, path, err)
+			}
+		}
+		project.resolvePaths(filepath.Dir(path))
+	}
+
+	return &file, nil
+}
+
+// Project returns the settings of a project, or empty settings if the
+// project is not defined
+func (f *ProjectFile) Project(name string) *ProjectConfig {
+	if project, ok := f.Projects[name]; ok {
+		return project
+	}
+	return &ProjectConfig{}
+}
+
+// Dir returns the directory containing the project file, or empty string if none was found
+func (f *ProjectFile) Dir() string {
+	if f.path == "" {
+		return ""
+	}
+	return filepath.Dir(f.path)
+}
+
+// resolvePaths makes the project's relative paths absolute
+func (p *ProjectConfig) resolvePaths(baseDir string) {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				return filepath.Join(home, path[2:])
+			}
+		}
+		return filepath.Join(baseDir, path)
+	}
+
+	p.InfraConfig = resolve(p.InfraConfig)
+	p.MachineModules = resolve(p.MachineModules)
+	p.SSH.KeyPath = resolve(p.SSH.KeyPath)
+	p.SSH.ConfigPath = resolve(p.SSH.ConfigPath)
+	// Bare binary names (e.g. "tofu") are looked up on PATH
+	if strings.ContainsRune(p.EnginePath, filepath.Separator) {
+		p.EnginePath = resolve(p.EnginePath)
+	}
+}
+
+// isHookStage reports whether stage is a known hook stage
+func isHookStage(stage string) bool {
+	switch stage {
+	case HookPreInfra, HookPostInfra, HookPreDeploy, HookPostDeploy, HookPreDestroy, HookPostDestroy:
+		return true
+	}
+	return false
+}
+
+// loadedProjectFile is the inframan.json loaded by InitProjectFile
+var loadedProjectFile *ProjectFile
+
+// InitProjectFile loads inframan.json once for the config getters, so that it
+// is not read and validated again for every setting and instance. It must be
+// called after SetProjectFilePath.
+func InitProjectFile() error {
+	file, err := LoadProjectFile()
+	if err != nil {
+		return err
+	}
+	loadedProjectFile = file
+	return nil
+}
+
+// currentProjectFile returns inframan.json for the config getters. Without
+// InitProjectFile (e.g. in tests), the file is loaded on every call and a
+// broken file is ignored with a warning.
+func currentProjectFile() *ProjectFile {
+	if loadedProjectFile != nil {
+		return loadedProjectFile
+	}
+	file, err := LoadProjectFile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring project file: %v\n", err)
+		return &ProjectFile{}
+	}
+	return file
+}
+
+// currentProjectConfig returns the inframan.json settings of the current project
+func currentProjectConfig() *ProjectConfig {
+	return currentProjectFile().Project(GetProjectName())
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// RunHooks runs the current project's hooks for a stage, in order, from the
+// directory containing inframan.json. Hooks run with sh -c and see
+// INFRAMAN_PROJECT and INFRAMAN_HOOK in their environment. Their output goes
+// to progress.
+func RunHooks(stage string, progress io.Writer) error {
+	file := currentProjectFile()
+	projectName := GetProjectName()
+	hooks := file.Project(projectName).Hooks[stage]
+
+	for _, hook := range hooks {
+		fmt.Fprintf(progress, "Running %s hook: %s\n", stage, hook)
+		cmd := &Command{
+			Name:   "sh",
+			Args:   []string{"-c", hook},
+			Dir:    file.Dir(),
+			Env:    append(os.Environ(), "INFRAMAN_PROJECT="+projectName, "INFRAMAN_HOOK="+stage),
+			Stdin:  stdin(),
+			Stdout: progress,
+			Stderr: os.Stderr,
+		}
+		if err := DefaultRunner.Run(cmd); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", stage, hook, err)
+		}
+	}
+
+	return nil
+}
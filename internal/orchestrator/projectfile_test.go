@@ -0,0 +1,204 @@
+package orchestrator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProjectFile = `{
+  "default_project": "staging",
+  "projects": {
+    "staging": {
+      "infra_config": "infra/staging.tf.json",
+      "machine_modules": "machines",
+      "engine": "tofu",
+      "ssh": {"user": "nixos", "key_path": "keys/staging"},
+      "hooks": {"pre_deploy": ["echo deploying"]}
+    },
+    "prod": {
+      "ssh": {"key_path": "/abs/prod"}
+    }
+  }
+}`
+
+// writeProjectFile writes inframan.json in the working directory and returns its directory
+func writeProjectFile(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ProjectFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestProjectFilePrecedence(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("PROJECT_NAME", "")
+	t.Setenv("INFRAMAN_ENGINE", "")
+	t.Setenv("INFRA_CONFIG_JSON", "")
+	t.Setenv("SSH_KEY_PATH", "")
+	t.Setenv("SSH_USER", "")
+	dir := writeProjectFile(t, testProjectFile)
+
+	// Values from the project file, paths resolved against its directory
+	if got := GetProjectName(); got != "staging" {
+		t.Errorf("GetProjectName() = %q, want staging", got)
+	}
+	if got, want := GetInfraConfigPath(), filepath.Join(dir, "infra/staging.tf.json"); got != want {
+		t.Errorf("GetInfraConfigPath() = %q, want %q", got, want)
+	}
+	if got, want := GetNixOSModulePath(), filepath.Join(dir, "machines"); got != want {
+		t.Errorf("GetNixOSModulePath() = %q, want %q", got, want)
+	}
+	if got := GetSSHUser(); got != "nixos" {
+		t.Errorf("GetSSHUser() = %q, want nixos", got)
+	}
+	if got := GetEngineName(); got != EngineTofu {
+		t.Errorf("GetEngineName() = %q, want tofu", got)
+	}
+
+	// Environment variables override the project file
+	t.Setenv("SSH_USER", "admin")
+	t.Setenv("INFRA_CONFIG_JSON", "/env/config.tf.json")
+	if got := GetSSHUser(); got != "admin" {
+		t.Errorf("GetSSHUser() = %q, want admin", got)
+	}
+	if got := GetInfraConfigPath(); got != "/env/config.tf.json" {
+		t.Errorf("GetInfraConfigPath() = %q, want env value", got)
+	}
+
+	// The --project flag overrides PROJECT_NAME and the default project
+	t.Setenv("PROJECT_NAME", "staging")
+	SetProjectName("prod")
+	t.Cleanup(func() { SetProjectName("") })
+	if got := GetProjectName(); got != "prod" {
+		t.Errorf("GetProjectName() = %q, want prod", got)
+	}
+	if got := GetSSHKeyPath(); got != "/abs/prod" {
+		t.Errorf("GetSSHKeyPath() = %q, want /abs/prod", got)
+	}
+	if got := GetSSHUser(); got != "admin" {
+		t.Errorf("GetSSHUser() = %q, want admin", got)
+	}
+}
+
+func TestFindProjectFileWalksUp(t *testing.T) {
+	setupWorkspace(t)
+	dir := writeProjectFile(t, `{"projects": {}}`)
+
+	sub := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(sub); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := FindProjectFile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(dir, ProjectFileName); path != want {
+		t.Errorf("FindProjectFile() = %q, want %q", path, want)
+	}
+}
+
+func TestFindProjectFileFromWorkspaceRoot(t *testing.T) {
+	setupWorkspace(t)
+	root := writeProjectFile(t, `{"projects": {}}`)
+
+	// The working directory is in another tree with its own inframan.json
+	other := t.TempDir()
+	if err := os.WriteFile(filepath.Join(other, ProjectFileName), []byte(`{"projects": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(other); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := FindProjectFile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(root, ProjectFileName); path != want {
+		t.Errorf("FindProjectFile() = %q, want %q", path, want)
+	}
+}
+
+func TestLoadProjectFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "invalid json", content: `{`, wantErr: "failed to parse project file"},
+		{name: "unknown hook", content: `{"projects": {"p": {"hooks": {"before_all": ["true"]}}}}`, wantErr: `unknown hook stage "before_all"`},
+		{name: "null project", content: `{"projects": {"p": null}}`, wantErr: "has no settings"},
+		{name: "invalid health check", content: `{"projects": {"p": {"health_checks": [{"tcp": 80, "systemd": "nginx.service"}]}}}`, wantErr: "exactly one of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupWorkspace(t)
+			writeProjectFile(t, tt.content)
+
+			_, err := LoadProjectFile()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInitProjectFile(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("PROJECT_NAME", "staging")
+	t.Setenv("SSH_USER", "")
+	t.Cleanup(func() { loadedProjectFile = nil })
+
+	writeProjectFile(t, `{`)
+	if err := InitProjectFile(); err == nil || !strings.Contains(err.Error(), "failed to parse project file") {
+		t.Fatalf("InitProjectFile() error = %v, want parse error", err)
+	}
+
+	writeProjectFile(t, testProjectFile)
+	if err := InitProjectFile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Later changes to the file are not read again during the run
+	writeProjectFile(t, `{`)
+	if got := GetSSHUser(); got != "nixos" {
+		t.Errorf("GetSSHUser() = %q, want nixos from the loaded file", got)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	fake := setupWorkspace(t)
+	t.Setenv("PROJECT_NAME", "staging")
+	writeProjectFile(t, testProjectFile)
+
+	var progress bytes.Buffer
+	if err := RunHooks(HookPreDeploy, &progress); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RunHooks(HookPostDeploy, &progress); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := strings.Join(fake.CommandLines(), "; "); got != "sh -c echo deploying" {
+		t.Errorf("commands = %q", got)
+	}
+	if calls := fake.Calls(); len(calls) != 1 || calls[0].Stdout != &progress {
+		t.Error("hook output is not written to progress")
+	}
+	if !strings.Contains(progress.String(), "Running pre_deploy hook: echo deploying") {
+		t.Errorf("progress = %q", progress.String())
+	}
+}
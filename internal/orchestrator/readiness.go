@@ -0,0 +1,99 @@
+package orchestrator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSSHPort is the port probed when waiting for instances
+	DefaultSSHPort = 22
+
+	// initialBackoff is the delay before the first retry of a readiness probe
+	initialBackoff = 2 * time.Second
+
+	// maxBackoff caps the delay between readiness probes
+	maxBackoff = 15 * time.Second
+
+	// probeTimeout bounds a single connection attempt
+	probeTimeout = 5 * time.Second
+)
+
+// probeSSH connects to addr and checks that an SSH server greets us.
+// A freshly booted host can accept TCP connections before sshd is ready.
+func probeSSH(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, probeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(probeTimeout)); err != nil {
+		return err
+	}
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no SSH banner: %w", err)
+	}
+	if !strings.HasPrefix(banner, "SSH-") {
+		return fmt.Errorf("unexpected banner %q", strings.TrimSpace(banner))
+	}
+	return nil
+}
+
+// WaitForSSH blocks until every instance accepts SSH connections on its
+// ssh_port, or port if it has none, retrying with exponential backoff until
+// timeout elapses. Instances behind a bastion are probed by running a no-op
+// command through it, as they cannot be reached directly. Each instance's
+// state is reported to progress.
+func WaitForSSH(instances []*InstanceInfo, port int, timeout time.Duration, progress io.Writer) error {
+	deadline := time.Now().Add(timeout)
+
+	for _, inst := range instances {
+		jump, err := ResolveJump(inst)
+		if err != nil {
+			return err
+		}
+
+		instPort := port
+		if inst.SSHPort != 0 {
+			instPort = inst.SSHPort
+		}
+		addr := net.JoinHostPort(TargetAddress(inst, jump), strconv.Itoa(instPort))
+		probe := func() error { return probeSSH(addr) }
+		if jump != "" {
+			probe = func() error {
+				_, err := RunRemote(inst, SSHOptions{}, "true")
+				return err
+			}
+		}
+		backoff := initialBackoff
+
+		for {
+			err := probe()
+			if err == nil {
+				fmt.Fprintf(progress, "  %-30s ready\n", inst.FullName())
+				break
+			}
+
+			if time.Now().Add(backoff).After(deadline) {
+				return fmt.Errorf("timed out waiting for SSH on %s (%s): %w", inst.FullName(), addr, err)
+			}
+
+			fmt.Fprintf(progress, "  %-30s not ready (%v), retrying in %s\n", inst.FullName(), err, backoff)
+			time.Sleep(backoff)
+
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package orchestrator
+
+import "github.com/iivel-inc/inframan/internal/runner"
+
+// Command describes an external process to run
+type Command = runner.Command
+
+// Runner executes external commands. Executors use it instead of os/exec
+// directly so they can be tested without the real binaries.
+type Runner = runner.Runner
+
+// ExecRunner runs commands with os/exec
+type ExecRunner = runner.ExecRunner
+
+// ErrTimeout is returned when a command is killed after exceeding its Timeout
+var ErrTimeout = runner.ErrTimeout
+
+// DefaultRunner is used by new executors and standalone functions
+var DefaultRunner Runner = ExecRunner{}
+
+// exitCode returns the exit code carried by err, if any
+func exitCode(err error) (int, bool) {
+	return runner.ExitCode(err)
+}
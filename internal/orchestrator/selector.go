@@ -0,0 +1,282 @@
+package orchestrator
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxListedNames caps the names listed in "no match" errors
+const maxListedNames = 10
+
+// Selector selects instances across projects. Each part is a glob pattern.
+type Selector struct {
+	Project  string
+	Instance string
+	Tag      string // Empty to match instances regardless of tags
+
+	raw string
+}
+
+// ParseSelector parses an instance selector:
+//
+//	project           every instance of a project
+//	project/instance  a single instance
+//	prod/web-*        globs in either part
+//	*/db-*            matching instances of all projects
+//	@web, prod/@web   instances tagged web (map tags match as key=value)
+func ParseSelector(selector string) (*Selector, error) {
+	if selector == "" {
+		return nil, fmt.Errorf("empty selector")
+	}
+
+	s := &Selector{Project: selector, Instance: "*", raw: selector}
+	if strings.HasPrefix(selector, "@") {
+		s.Project, s.Tag = "*", selector[1:]
+	} else if i := strings.Index(selector, "/"); i >= 0 {
+		s.Project, s.Instance = selector[:i], selector[i+1:]
+		if strings.HasPrefix(s.Instance, "@") {
+			s.Instance, s.Tag = "*", s.Instance[1:]
+		}
+	}
+
+	for _, pattern := range []string{s.Project, s.Instance, s.Tag} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+	}
+	if s.Project == "" {
+		return nil, fmt.Errorf("invalid selector %q: missing project", selector)
+	}
+	if s.Tag == "" && strings.HasSuffix(selector, "@") {
+		return nil, fmt.Errorf("invalid selector %q: missing tag", selector)
+	}
+
+	return s, nil
+}
+
+// String returns the selector as it was written
+func (s *Selector) String() string {
+	return s.raw
+}
+
+// MatchesProject reports whether the selector's project part matches a project
+func (s *Selector) MatchesProject(projectName string) bool {
+	matched, _ := path.Match(s.Project, projectName)
+	return matched
+}
+
+// WholeProjects reports whether the selector selects entire projects rather
+// than some of their instances
+func (s *Selector) WholeProjects() bool {
+	return s.Instance == "*" && s.Tag == ""
+}
+
+// Match reports whether an instance matches the selector
+func (s *Selector) Match(inst *InstanceInfo) bool {
+	if !s.MatchesProject(inst.ProjectName) {
+		return false
+	}
+	if matched, _ := path.Match(s.Instance, inst.InstanceName); !matched {
+		return false
+	}
+	if s.Tag == "" {
+		return true
+	}
+	for _, tag := range inst.Tags {
+		if matched, _ := path.Match(s.Tag, tag); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the instances matching the selector. If none match, the
+// error lists the candidates closest to the selector.
+func (s *Selector) Filter(instances []*InstanceInfo) ([]*InstanceInfo, error) {
+	var selected []*InstanceInfo
+	for _, inst := range instances {
+		if s.Match(inst) {
+			selected = append(selected, inst)
+		}
+	}
+	if len(selected) > 0 {
+		return selected, nil
+	}
+
+	if s.Tag != "" {
+		var tags []string
+		seen := make(map[string]bool)
+		for _, inst := range instances {
+			for _, tag := range inst.Tags {
+				if !seen[tag] {
+					seen[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+		}
+		sort.Strings(tags)
+		return nil, fmt.Errorf("no instances match %q%s", s.raw, suggest(s.Tag, tags, "tags"))
+	}
+
+	names := make([]string, len(instances))
+	for i, inst := range instances {
+		names[i] = inst.FullName()
+	}
+	return nil, fmt.Errorf("no instances match %q%s", s.raw, suggest(s.raw, names, "instances"))
+}
+
+// SelectInstances returns the instances of all projects matching a selector
+func SelectInstances(selector string) ([]*InstanceInfo, error) {
+	s, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := s.projects()
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*InstanceInfo
+	for _, project := range projects {
+		projectInstances, err := GetInstancesForProject(project)
+		if err != nil {
+			if len(projects) == 1 {
+				return nil, err
+			}
+			// Don't let one broken project hide the others
+			fmt.Fprintf(os.Stderr, "Warning: skipping project %q: %v\n", project, err)
+			continue
+		}
+		instances = append(instances, projectInstances...)
+	}
+
+	return s.Filter(instances)
+}
+
+// SelectProjects returns the projects matching a selector that selects
+// whole projects, such as "staging" or "staging-*"
+func SelectProjects(selector string) ([]string, error) {
+	s, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	if !s.WholeProjects() {
+		return nil, fmt.Errorf("selector %q must select whole projects, not instances", selector)
+	}
+	return s.projects()
+}
+
+// projects returns the projects matching the selector's project part. A plain
+// project name must exist; a glob must match at least one project.
+func (s *Selector) projects() ([]string, error) {
+	all, err := GetAllProjectDirs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+
+	var matched []string
+	for _, project := range all {
+		if s.MatchesProject(project) {
+			matched = append(matched, project)
+		}
+	}
+	if len(matched) > 0 {
+		return matched, nil
+	}
+
+	if !hasGlob(s.Project) {
+		return nil, fmt.Errorf("project %q does not exist%s", s.Project, suggest(s.Project, all, "projects"))
+	}
+	return nil, fmt.Errorf("no projects match %q%s", s.Project, suggest(s.Project, all, "projects"))
+}
+
+// hasGlob reports whether a pattern contains glob metacharacters
+func hasGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// suggest returns an error suffix naming the candidates closest to target,
+// or all candidates if none is close
+func suggest(target string, candidates []string, kind string) string {
+	if len(candidates) == 0 {
+		return fmt.Sprintf("; no %s found", kind)
+	}
+
+	// Compare a glob by its literal prefix, e.g. "prod/wbe-" for "prod/wbe-*"
+	literal := target
+	if i := strings.IndexAny(target, `*?[\`); i >= 0 {
+		literal = target[:i]
+	}
+	if literal == "" {
+		return fmt.Sprintf("; available %s: %s", kind, listNames(candidates))
+	}
+	threshold := len(literal) / 4
+	if threshold < 2 {
+		threshold = 2
+	}
+
+	distances := make([]int, len(candidates))
+	best := threshold
+	for i, candidate := range candidates {
+		if literal != target && len(candidate) > len(literal) {
+			candidate = candidate[:len(literal)]
+		}
+		distances[i] = editDistance(literal, candidate)
+		if distances[i] < best {
+			best = distances[i]
+		}
+	}
+
+	// Keep the closest candidates, allowing one more edit than the best
+	var near []string
+	for i, candidate := range candidates {
+		if distances[i] <= threshold && distances[i] <= best+1 {
+			near = append(near, candidate)
+		}
+	}
+	if len(near) > 0 {
+		return fmt.Sprintf("; did you mean %s?", listNames(near))
+	}
+	return fmt.Sprintf("; available %s: %s", kind, listNames(candidates))
+}
+
+// listNames joins names, eliding all but the first maxListedNames
+func listNames(names []string) string {
+	if len(names) > maxListedNames {
+		return fmt.Sprintf("%s, ... (%d more)", strings.Join(names[:maxListedNames], ", "), len(names)-maxListedNames)
+	}
+	return strings.Join(names, ", ")
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,116 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestSelectInstances(t *testing.T) {
+	fake := setupWorkspace(t)
+	fake.On("terraform output -json", orchestratortest.FakeResponse{Stdout: `{
+		"instances": {"value": {"web-1": "10.0.0.1", "web-2": "10.0.0.2", "db-1": "10.0.0.3"}},
+		"instance_tags": {"value": {"web-1": ["web", "canary"], "web-2": ["web"], "db-1": {"role": "db"}}}
+	}`})
+	for _, project := range []string{"prod", "staging"} {
+		createProject(t, project)
+		if err := recordEngine(project, &Engine{Name: EngineTerraform, Binary: EngineTerraform}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		selector string
+		want     []string
+		wantErr  string
+	}{
+		{selector: "prod", want: []string{"prod/db-1", "prod/web-1", "prod/web-2"}},
+		{selector: "prod/web-2", want: []string{"prod/web-2"}},
+		{selector: "prod/web-*", want: []string{"prod/web-1", "prod/web-2"}},
+		{selector: "*/db-*", want: []string{"prod/db-1", "staging/db-1"}},
+		{selector: "@canary", want: []string{"prod/web-1", "staging/web-1"}},
+		{selector: "prod/@role=db", want: []string{"prod/db-1"}},
+		{selector: "staging/@web", want: []string{"staging/web-1", "staging/web-2"}},
+		{selector: "prod/cache-*", wantErr: `no instances match "prod/cache-*"; available instances: prod/db-1, prod/web-1, prod/web-2`},
+		{selector: "prod/web-3", wantErr: `did you mean prod/web-1, prod/web-2?`},
+		{selector: "prod/@wbe", wantErr: `no instances match "prod/@wbe"; did you mean web?`},
+		{selector: "prdo", wantErr: `project "prdo" does not exist; did you mean prod?`},
+		{selector: "dev-*", wantErr: `no projects match "dev-*"; available projects: prod, staging`},
+		{selector: "prod/[", wantErr: "invalid selector"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			instances, err := SelectInstances(tt.selector)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, inst := range instances {
+				got = append(got, inst.FullName())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("SelectInstances(%q) = %v, want %v", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector               string
+		project, instance, tag string
+		wantErr                bool
+	}{
+		{selector: "account1", project: "account1", instance: "*"},
+		{selector: "production/web-1", project: "production", instance: "web-1"},
+		{selector: "production/web/1", project: "production", instance: "web/1"},
+		{selector: "*/db-*", project: "*", instance: "db-*"},
+		{selector: "@web", project: "*", instance: "*", tag: "web"},
+		{selector: "prod/@role=db", project: "prod", instance: "*", tag: "role=db"},
+		{selector: "", wantErr: true},
+		{selector: "/web-1", wantErr: true},
+		{selector: "prod/@", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseSelector(tt.selector)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSelector(%q) error = %v, wantErr %v", tt.selector, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if s.Project != tt.project || s.Instance != tt.instance || s.Tag != tt.tag {
+			t.Errorf("ParseSelector(%q) = (%q, %q, %q), want (%q, %q, %q)", tt.selector, s.Project, s.Instance, s.Tag, tt.project, tt.instance, tt.tag)
+		}
+	}
+}
+
+func TestSelectProjects(t *testing.T) {
+	setupWorkspace(t)
+	for _, project := range []string{"prod", "staging-eu", "staging-us"} {
+		createProject(t, project)
+	}
+
+	projects, err := SelectProjects("staging-*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(projects, ",") != "staging-eu,staging-us" {
+		t.Errorf("SelectProjects() = %v", projects)
+	}
+
+	if _, err := SelectProjects("prod/web-1"); err == nil || !strings.Contains(err.Error(), "must select whole projects") {
+		t.Errorf("error = %v, want whole projects error", err)
+	}
+}
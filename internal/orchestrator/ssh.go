@@ -0,0 +1,201 @@
+package orchestrator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sshConnectTimeout bounds connection setup for non-interactive SSH commands
+	sshConnectTimeout = "10"
+
+	// sshConnectionFailed is the exit code ssh uses for its own errors
+	// (connection refused, authentication failure, ...)
+	sshConnectionFailed = 255
+)
+
+// SSHOptions selects the user and identity for an SSH connection. Empty
+// fields fall back to the instance's ssh_user output, SSH_USER,
+// SSH_KEY_PATH and the ssh settings of the instance's project in
+// inframan.json.
+type SSHOptions struct {
+	User         string
+	IdentityFile string
+}
+
+// user returns the SSH user to connect to an instance as
+func (o SSHOptions) user(inst *InstanceInfo) string {
+	return firstNonEmpty(o.User, inst.SSHUser, projectSSHConfig(inst.ProjectName).User)
+}
+
+// SSHUserFor returns the user to connect to an instance as when no user is
+// given explicitly
+func SSHUserFor(inst *InstanceInfo) string {
+	return SSHOptions{}.user(inst)
+}
+
+// SSHArgs returns the ssh arguments (without the command to run) for
+// connecting to an instance, through its jump host if it has one
+func SSHArgs(inst *InstanceInfo, opts SSHOptions) ([]string, error) {
+	sshArgs, user, host, err := sshConnection(inst, opts)
+	if err != nil {
+		return nil, err
+	}
+	if inst.SSHPort != 0 {
+		sshArgs = append(sshArgs, "-p", strconv.Itoa(inst.SSHPort))
+	}
+	return append(sshArgs, user+"@"+host), nil
+}
+
+// sshConnection returns the options shared by ssh, scp and rsync for
+// connecting to an instance (everything but the port), and the user and
+// host to connect to
+func sshConnection(inst *InstanceInfo, opts SSHOptions) (sshArgs []string, user, host string, err error) {
+	jump, err := ResolveJump(inst)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	// Settings of the instance's project, which need not be the current one
+	ssh := projectSSHConfig(inst.ProjectName)
+
+	// Add SSH config file if SSH_CONFIG_PATH is set (takes precedence)
+	if ssh.ConfigPath != "" {
+		sshArgs = append(sshArgs, "-F", ssh.ConfigPath)
+	} else if opts.IdentityFile != "" {
+		// Add identity file if specified via flag
+		sshArgs = append(sshArgs, "-i", opts.IdentityFile)
+	} else if ssh.KeyPath != "" {
+		// Fall back to SSH_KEY_PATH env var
+		sshArgs = append(sshArgs, "-i", ssh.KeyPath)
+	}
+
+	// Verify host keys against the project's known_hosts (only if not using
+	// custom config)
+	if ssh.ConfigPath == "" {
+		hostKeyOpts, err := hostKeyOptions(inst)
+		if err != nil {
+			return nil, "", "", err
+		}
+		sshArgs = append(sshArgs, optionArgs(hostKeyOpts)...)
+		sshArgs = append(sshArgs, "-o", "LogLevel=ERROR")
+	}
+
+	// Never fall back to password or passphrase prompts in non-interactive mode
+	if IsNonInteractive() {
+		sshArgs = append(sshArgs, "-o", "BatchMode=yes")
+	}
+
+	jumpOpts, err := jumpOptions(inst)
+	if err != nil {
+		return nil, "", "", err
+	}
+	sshArgs = append(sshArgs, optionArgs(jumpOpts)...)
+
+	return sshArgs, opts.user(inst), TargetAddress(inst, jump), nil
+}
+
+// SSHError is returned by RunRemote when the command could not be run on the host
+type SSHError struct {
+	Instance string
+	Err      error
+	Stderr   string
+}
+
+// Error implements error
+func (e *SSHError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("cannot reach %s: %v: %s", e.Instance, e.Err, e.Stderr)
+	}
+	return fmt.Sprintf("cannot reach %s: %v", e.Instance, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *SSHError) Unwrap() error {
+	return e.Err
+}
+
+// remoteCommand returns the ssh command running a shell command on an
+// instance without a terminal
+func remoteCommand(inst *InstanceInfo, opts SSHOptions, command string) (*Command, error) {
+	sshArgs, err := SSHArgs(inst, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=" + sshConnectTimeout}
+	args = append(args, sshArgs...)
+	args = append(args, command)
+
+	return &Command{
+		Name: "ssh",
+		Args: args,
+		Env:  os.Environ(),
+	}, nil
+}
+
+// remoteError classifies the error of an ssh command: connection failures
+// are returned as *SSHError, timeouts as is and a failing remote command as
+// nil with its exit status
+func remoteError(inst *InstanceInfo, err error, stderr string) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	if errors.Is(err, ErrTimeout) {
+		return 0, fmt.Errorf("command on %s %w", inst.FullName(), err)
+	}
+	code, ok := exitCode(err)
+	if !ok || code == sshConnectionFailed {
+		return 0, &SSHError{Instance: inst.FullName(), Err: err, Stderr: strings.TrimSpace(stderr)}
+	}
+	return code, nil
+}
+
+// RunRemote runs a shell command on an instance over SSH without a terminal
+// and returns its standard output. Connection failures are returned as
+// *SSHError; a failing remote command returns its exit status.
+func RunRemote(inst *InstanceInfo, opts SSHOptions, command string) (string, error) {
+	cmd, err := remoteCommand(inst, opts, command)
+	if err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := DefaultRunner.Output(cmd)
+	code, err := remoteError(inst, err, stderr.String())
+	if err != nil {
+		return "", err
+	}
+	if code != 0 {
+		return string(output), fmt.Errorf("command failed on %s: exit status %d: %s", inst.FullName(), code, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(output), nil
+}
+
+// StreamRemote runs a shell command on an instance over SSH without a
+// terminal, writing its output to stdout and stderr as it is produced, and
+// returns the command's exit status. The error is set only if the command
+// could not run to completion: the connection failed (*SSHError) or it ran
+// longer than timeout (0 for no limit).
+func StreamRemote(inst *InstanceInfo, opts SSHOptions, command string, stdout, stderr io.Writer, timeout time.Duration) (int, error) {
+	// Keep ssh's own error messages for the *SSHError as well
+	cmd, err := remoteCommand(inst, opts, command)
+	if err != nil {
+		return 0, err
+	}
+	var sshStderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(stderr, &sshStderr)
+	cmd.Timeout = timeout
+
+	err = DefaultRunner.Run(cmd)
+	return remoteError(inst, err, sshStderr.String())
+}
@@ -0,0 +1,93 @@
+package orchestrator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestSSHArgs(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("SSH_CONFIG_PATH", "")
+	t.Setenv("SSH_KEY_PATH", "/keys/default")
+	t.Setenv("SSH_USER", "")
+	inst := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.1"}
+	sshArgs := func(inst *InstanceInfo, opts SSHOptions) string {
+		t.Helper()
+		args, err := SSHArgs(inst, opts)
+		if err != nil {
+			t.Fatalf("SSHArgs() error = %v", err)
+		}
+		return strings.Join(args, " ")
+	}
+
+	got := sshArgs(inst, SSHOptions{})
+	if !strings.HasPrefix(got, "-i /keys/default ") || !strings.HasSuffix(got, " root@10.0.0.1") {
+		t.Errorf("SSHArgs() = %q", got)
+	}
+
+	got = sshArgs(inst, SSHOptions{User: "nixos", IdentityFile: "/keys/mine"})
+	if !strings.HasPrefix(got, "-i /keys/mine ") || !strings.HasSuffix(got, " nixos@10.0.0.1") {
+		t.Errorf("SSHArgs() with options = %q", got)
+	}
+
+	// The instance's ssh_user and ssh_port from terraform output
+	rich := &InstanceInfo{ProjectName: "prod", InstanceName: "db-1", PrivateIP: "10.1.0.5", SSHUser: "ubuntu", SSHPort: 2222}
+	got = sshArgs(rich, SSHOptions{})
+	if !strings.HasSuffix(got, " -p 2222 ubuntu@10.1.0.5") {
+		t.Errorf("SSHArgs() with instance settings = %q", got)
+	}
+	got = sshArgs(rich, SSHOptions{User: "nixos"})
+	if !strings.HasSuffix(got, " nixos@10.1.0.5") {
+		t.Errorf("SSHArgs() with instance settings and user = %q", got)
+	}
+
+	t.Setenv("SSH_CONFIG_PATH", "/ssh/config")
+	got = sshArgs(inst, SSHOptions{IdentityFile: "/keys/mine"})
+	if got != "-F /ssh/config root@10.0.0.1" {
+		t.Errorf("SSHArgs() with config = %q", got)
+	}
+}
+
+func TestGetCurrentSystem(t *testing.T) {
+	inst := &InstanceInfo{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.1"}
+
+	tests := []struct {
+		name            string
+		resp            orchestratortest.FakeResponse
+		want            string
+		wantUnreachable bool
+		wantErr         bool
+	}{
+		{name: "store path", resp: orchestratortest.FakeResponse{Stdout: "/nix/store/abc-nixos-system\n"}, want: "/nix/store/abc-nixos-system"},
+		{name: "connection failed", resp: orchestratortest.FakeResponse{ExitCode: 255}, wantUnreachable: true, wantErr: true},
+		{name: "command failed", resp: orchestratortest.FakeResponse{ExitCode: 1}, wantErr: true},
+		{name: "not a store path", resp: orchestratortest.FakeResponse{Stdout: "/run/current-system\n"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupWorkspace(t)
+			fake.On("ssh", tt.resp)
+
+			got, err := GetCurrentSystem(inst, SSHOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var sshErr *SSHError
+			if errors.As(err, &sshErr) != tt.wantUnreachable {
+				t.Errorf("error = %v, want unreachable %v", err, tt.wantUnreachable)
+			}
+			if got != tt.want {
+				t.Errorf("GetCurrentSystem() = %q, want %q", got, tt.want)
+			}
+
+			line := fake.CommandLines()[0]
+			if !strings.Contains(line, "BatchMode=yes") || !strings.HasSuffix(line, "readlink -f /run/current-system") {
+				t.Errorf("command = %q", line)
+			}
+		})
+	}
+}
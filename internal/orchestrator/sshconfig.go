@@ -0,0 +1,139 @@
+package orchestrator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SSHConfigFileName is the name of the generated SSH config file in .inframan/
+const SSHConfigFileName = "ssh_config"
+
+// GetSSHConfigFilePath returns the path of the generated SSH config file
+// Structure: .inframan/ssh_config
+func GetSSHConfigFilePath() (string, error) {
+	inframanDir, err := GetInframanDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(inframanDir, SSHConfigFileName), nil
+}
+
+// SSHHostAlias returns the Host alias of an instance in the generated SSH
+// config, e.g. "production-web-1"
+func SSHHostAlias(inst *InstanceInfo) string {
+	return strings.ReplaceAll(inst.FullName(), "/", "-")
+}
+
+// quoteConfigValue quotes an ssh_config value containing spaces
+func quoteConfigValue(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// sshConfigBlock returns the Host block of an instance
+func sshConfigBlock(inst *InstanceInfo) (string, error) {
+	jump, err := ResolveJump(inst)
+	if err != nil {
+		return "", err
+	}
+
+	options := []sshOption{
+		{Key: "HostName", Value: TargetAddress(inst, jump)},
+		{Key: "User", Value: SSHUserFor(inst)},
+	}
+	if inst.SSHPort != 0 {
+		options = append(options, sshOption{Key: "Port", Value: strconv.Itoa(inst.SSHPort)})
+	}
+	if sshKeyPath := projectSSHConfig(inst.ProjectName).KeyPath; sshKeyPath != "" {
+		options = append(options, sshOption{Key: "IdentityFile", Value: sshKeyPath})
+	}
+	jumpOpts, err := jumpOptions(inst)
+	if err != nil {
+		return "", err
+	}
+	options = append(options, jumpOpts...)
+	hostKeyOpts, err := hostKeyOptions(inst)
+	if err != nil {
+		return "", err
+	}
+	options = append(options, hostKeyOpts...)
+
+	var block strings.Builder
+	fmt.Fprintf(&block, "# %s\nHost %s\n", inst.FullName(), SSHHostAlias(inst))
+	for _, option := range options {
+		value := quoteConfigValue(option.Value)
+		if option.Key == "ProxyCommand" {
+			// The command extends to the end of the line and is run by sh
+			value = option.Value
+		}
+		fmt.Fprintf(&block, "  %s %s\n", option.Key, value)
+	}
+	return block.String(), nil
+}
+
+// GenerateSSHConfig returns an SSH config with a Host block per instance,
+// suitable for Include from ~/.ssh/config, and the number of blocks written.
+// Instances whose bastion or host key cannot be resolved, or whose Host alias
+// is already taken by another instance (e.g. prod-web/1 and prod/web-1), are
+// skipped with a warning.
+func GenerateSSHConfig(instances []*InstanceInfo) (string, int) {
+	var config strings.Builder
+	config.WriteString("# Generated by inframan ssh-config. Do not edit; changes are overwritten.\n")
+
+	aliases := map[string]*InstanceInfo{}
+	count := 0
+	for _, inst := range instances {
+		alias := SSHHostAlias(inst)
+		if other, ok := aliases[alias]; ok {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: Host alias %s is already used by %s\n", inst.FullName(), alias, other.FullName())
+			continue
+		}
+		block, err := sshConfigBlock(inst)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", inst.FullName(), err)
+			continue
+		}
+		aliases[alias] = inst
+		config.WriteString("\n" + block)
+		count++
+	}
+	return config.String(), count
+}
+
+// WriteSSHConfig writes the SSH config of all instances of all projects to path
+// and returns the number of hosts written
+func WriteSSHConfig(path string) (int, error) {
+	instances, err := GetAllInstances()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return 0, err
+	}
+	config, count := GenerateSSHConfig(instances)
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write SSH config: %w", err)
+	}
+	return count, nil
+}
+
+// RefreshSSHConfig regenerates .inframan/ssh_config if it was generated
+// before, so that it follows infrastructure changes
+func RefreshSSHConfig() error {
+	path, err := GetSSHConfigFilePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	_, err = WriteSSHConfig(path)
+	return err
+}
@@ -0,0 +1,130 @@
+package orchestrator
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestGenerateSSHConfig(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("SSH_USER", "")
+	t.Setenv("SSH_KEY_PATH", "/keys/my key")
+	t.Setenv("SSH_BASTION", "jump.example.com")
+	knownHosts, err := GetKnownHostsPath("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, count := GenerateSSHConfig([]*InstanceInfo{
+		{ProjectName: "prod", InstanceName: "db-1", PublicIP: "1.2.3.4", PrivateIP: "10.1.0.5", SSHUser: "ubuntu", SSHPort: 2222},
+		{ProjectName: "prod", InstanceName: "web-1", PublicIP: "5.6.7.8", Bastion: "admin@other.example.com"},
+	})
+	if count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+
+	for _, want := range []string{
+		"# prod/db-1\nHost prod-db-1\n  HostName 10.1.0.5\n  User ubuntu\n  Port 2222\n  IdentityFile \"/keys/my key\"\n" +
+			"  ProxyCommand ssh -i '/keys/my key' -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=" + knownHosts + " jump.example.com -W %h:%p\n" +
+			"  StrictHostKeyChecking accept-new\n  UserKnownHostsFile " + knownHosts + "\n  HostKeyAlias prod/db-1\n",
+		"Host prod-web-1\n  HostName 5.6.7.8\n  User root\n",
+		" admin@other.example.com -W %h:%p\n",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("config missing %q:\n%s", want, config)
+		}
+	}
+}
+
+func TestGenerateSSHConfigSkipsHosts(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("SSH_BASTION", "")
+
+	config, count := GenerateSSHConfig([]*InstanceInfo{
+		{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.1"},
+		// Same alias as prod/web-1
+		{ProjectName: "prod-web", InstanceName: "1", PublicIP: "10.0.0.2"},
+		// Unresolvable bastion
+		{ProjectName: "prod", InstanceName: "db-1", PublicIP: "10.0.0.3", Bastion: "@missing"},
+	})
+
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+	if got := strings.Count(config, "Host prod-web-1\n"); got != 1 {
+		t.Errorf("config has %d prod-web-1 blocks, want 1:\n%s", got, config)
+	}
+	if !strings.Contains(config, "HostName 10.0.0.1\n") || strings.Contains(config, "10.0.0.2") {
+		t.Errorf("config does not keep the first prod-web-1:\n%s", config)
+	}
+}
+
+func TestRefreshSSHConfig(t *testing.T) {
+	fake := setupWorkspace(t)
+	createProject(t, "prod")
+	fake.On("terraform output -json", orchestratortest.FakeResponse{Stdout: `{"instances": {"value": {"web-1": "10.0.0.1"}}}`})
+
+	// Not generated before: nothing to refresh
+	if err := RefreshSSHConfig(); err != nil {
+		t.Fatal(err)
+	}
+	path, err := GetSSHConfigFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("RefreshSSHConfig() created %s", path)
+	}
+
+	if err := os.WriteFile(path, []byte("# stale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RefreshSSHConfig(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Host prod-web-1\n  HostName 10.0.0.1\n") {
+		t.Errorf("refreshed config = %q", data)
+	}
+}
+
+func TestSSHSettingsPerProject(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("SSH_USER", "")
+	t.Setenv("SSH_KEY_PATH", "")
+	t.Setenv("SSH_CONFIG_PATH", "")
+	writeProjectFile(t, `{"projects": {
+		"prod": {"ssh": {"user": "admin", "key_path": "/keys/prod"}},
+		"staging": {"ssh": {"user": "nixos", "key_path": "/keys/staging"}}
+	}}`)
+
+	// The current project is prod; staging instances use staging's settings
+	staging := &InstanceInfo{ProjectName: "staging", InstanceName: "web-1", PublicIP: "10.0.0.1"}
+	args, err := SSHArgs(staging, SSHOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(args, " ")
+	if !strings.HasPrefix(got, "-i /keys/staging ") || !strings.HasSuffix(got, " nixos@10.0.0.1") {
+		t.Errorf("SSHArgs() for staging = %q", got)
+	}
+
+	config, _ := GenerateSSHConfig([]*InstanceInfo{
+		{ProjectName: "prod", InstanceName: "web-1", PublicIP: "10.0.0.2"},
+		staging,
+	})
+	for _, want := range []string{
+		"Host prod-web-1\n  HostName 10.0.0.2\n  User admin\n  IdentityFile /keys/prod\n",
+		"Host staging-web-1\n  HostName 10.0.0.1\n  User nixos\n  IdentityFile /keys/staging\n",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("config missing %q:\n%s", want, config)
+		}
+	}
+}
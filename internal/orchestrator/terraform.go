@@ -3,20 +3,31 @@ package orchestrator
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-// TerraformExecutor handles Terraform command execution
+// TerraformExecutor handles Terraform (or OpenTofu) command execution
 type TerraformExecutor struct {
-	workDir string
+	projectName string
+	workDir     string
+	engine      *Engine
+	runner      Runner
+	stdout      io.Writer
 }
 
-// NewTerraformExecutor creates a new Terraform executor
+// NewTerraformExecutor creates a new Terraform executor for the current project
 func NewTerraformExecutor() (*TerraformExecutor, error) {
-	workDir, err := GetTerraformDir()
+	return NewTerraformExecutorForProject(GetProjectName())
+}
+
+// NewTerraformExecutorForProject creates a new Terraform executor for a specific project
+func NewTerraformExecutorForProject(projectName string) (*TerraformExecutor, error) {
+	workDir, err := GetTerraformDirForProject(projectName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get terraform directory: %w", err)
 	}
@@ -26,7 +37,23 @@ func NewTerraformExecutor() (*TerraformExecutor, error) {
 		return nil, err
 	}
 
-	return &TerraformExecutor{workDir: workDir}, nil
+	engine, err := ResolveEngine(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve engine: %w", err)
+	}
+
+	return &TerraformExecutor{projectName: projectName, workDir: workDir, engine: engine, runner: DefaultRunner, stdout: os.Stdout}, nil
+}
+
+// SetRunner replaces the runner used to execute terraform commands
+func (t *TerraformExecutor) SetRunner(runner Runner) {
+	t.runner = runner
+}
+
+// SetOutput sets where terraform output and progress messages are written
+// (default: stdout)
+func (t *TerraformExecutor) SetOutput(w io.Writer) {
+	t.stdout = w
 }
 
 // SetupWorkdir creates the workdir and copies the config file
@@ -46,21 +73,34 @@ func (t *TerraformExecutor) SetupWorkdir(configPath string) error {
 	return nil
 }
 
+// withInputArgs appends the flags that stop terraform from prompting when
+// running non-interactively. autoApprove is set for commands that ask for
+// confirmation (apply, destroy).
+func withInputArgs(args []string, autoApprove bool) []string {
+	if !IsNonInteractive() {
+		return args
+	}
+	if autoApprove {
+		args = append(args, "-auto-approve")
+	}
+	return append(args, "-input=false")
+}
+
 // Init runs terraform init
 func (t *TerraformExecutor) Init() error {
-	cmd := exec.Command("terraform", "init")
+	cmd := &Command{Name: t.engine.Binary, Args: withInputArgs([]string{"init"}, false)}
 	cmd.Dir = t.workDir
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = t.stdout
 	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	cmd.Stdin = stdin()
 	// Pass through environment (includes AWS credentials)
 	cmd.Env = os.Environ()
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("terraform init failed: %w", err)
+	if err := t.runner.Run(cmd); err != nil {
+		return fmt.Errorf("%s init failed: %w", t.engine.Name, err)
 	}
 
-	return nil
+	return recordEngine(t.projectName, t.engine)
 }
 
 // IsInitialized checks if terraform has been initialized in the workdir
@@ -77,60 +117,206 @@ func (t *TerraformExecutor) EnsureInit() error {
 	if t.IsInitialized() {
 		return nil
 	}
-	fmt.Println("Initializing Terraform...")
+	fmt.Fprintf(t.stdout, "Initializing %s...\n", t.engine.Name)
 	return t.Init()
 }
 
 // ensureInitInDir ensures terraform is initialized in the specified directory
-// This is a helper for standalone functions that don't use TerraformExecutor
-func ensureInitInDir(terraformDir string) error {
+// This is a helper for standalone functions that don't use TerraformExecutor.
+// They only look up state, so init output goes to stderr, away from results.
+func ensureInitInDir(terraformDir string, engine *Engine) error {
 	dotTerraformDir := filepath.Join(terraformDir, ".terraform")
 	if _, err := os.Stat(dotTerraformDir); err == nil {
 		// Already initialized
 		return nil
 	}
 
-	fmt.Printf("Initializing Terraform in %s...\n", terraformDir)
-	cmd := exec.Command("terraform", "init")
+	fmt.Fprintf(os.Stderr, "Initializing %s in %s...\n", engine.Name, terraformDir)
+	cmd := &Command{Name: engine.Binary, Args: withInputArgs([]string{"init"}, false)}
 	cmd.Dir = terraformDir
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
 	cmd.Env = os.Environ()
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("terraform init failed: %w", err)
+	if err := DefaultRunner.Run(cmd); err != nil {
+		return fmt.Errorf("%s init failed: %w", engine.Name, err)
 	}
 	return nil
 }
 
 // Apply runs terraform apply
 func (t *TerraformExecutor) Apply() error {
-	cmd := exec.Command("terraform", "apply")
+	cmd := &Command{Name: t.engine.Binary, Args: withInputArgs([]string{"apply"}, true)}
 	cmd.Dir = t.workDir
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = t.stdout
 	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	cmd.Stdin = stdin()
 	// Pass through environment (includes AWS credentials)
 	cmd.Env = os.Environ()
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("terraform apply failed: %w", err)
+	if err := t.runner.Run(cmd); err != nil {
+		return fmt.Errorf("%s apply failed: %w", t.engine.Name, err)
+	}
+
+	return nil
+}
+
+// Plan runs terraform plan and saves the plan to planPath
+func (t *TerraformExecutor) Plan(planPath string) error {
+	cmd := &Command{Name: t.engine.Binary, Args: withInputArgs([]string{"plan", "-out=" + planPath}, false)}
+	cmd.Dir = t.workDir
+	cmd.Stdout = t.stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = stdin()
+	cmd.Env = os.Environ()
+
+	if err := t.runner.Run(cmd); err != nil {
+		return fmt.Errorf("%s plan failed: %w", t.engine.Name, err)
+	}
+
+	return nil
+}
+
+// PlanChanges runs terraform plan with -detailed-exitcode, saving the plan to
+// planPath, and reports whether the plan contains changes. With destroy set,
+// a destroy plan is created instead.
+func (t *TerraformExecutor) PlanChanges(planPath string, destroy bool) (bool, error) {
+	args := []string{"plan", "-detailed-exitcode", "-out=" + planPath}
+	if destroy {
+		args = append(args, "-destroy")
+	}
+	return t.planDetailed(args, t.stdout)
+}
+
+// PlanRefreshOnly runs a refresh-only plan, saving it to planPath, and reports
+// whether the live infrastructure drifted from the state. Terraform's own
+// output is discarded; use ShowPlan to inspect the drift.
+func (t *TerraformExecutor) PlanRefreshOnly(planPath string) (bool, error) {
+	return t.planDetailed([]string{"plan", "-refresh-only", "-detailed-exitcode", "-out=" + planPath}, nil)
+}
+
+// planDetailed runs a plan with -detailed-exitcode and reports whether it has changes
+func (t *TerraformExecutor) planDetailed(args []string, stdout io.Writer) (bool, error) {
+	cmd := &Command{Name: t.engine.Binary, Args: withInputArgs(args, false)}
+	cmd.Dir = t.workDir
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = stdin()
+	cmd.Env = os.Environ()
+
+	err := t.runner.Run(cmd)
+	if err == nil {
+		return false, nil
+	}
+
+	// Exit code 2 means the plan succeeded and contains changes
+	if code, ok := exitCode(err); ok && code == 2 {
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%s plan failed: %w", t.engine.Name, err)
+}
+
+// ApplyChanges plans and applies without prompting, reporting whether
+// anything changed. It is used in non-interactive mode so callers can tell
+// "no changes" apart from "changes applied".
+func (t *TerraformExecutor) ApplyChanges(destroy bool) (bool, error) {
+	planPath := filepath.Join(t.workDir, autoPlanFileName)
+	defer os.Remove(planPath)
+
+	changed, err := t.PlanChanges(planPath, destroy)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if err := t.ApplyPlan(planPath); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DetectDrift runs a refresh-only plan and reports whether the live
+// infrastructure drifted from the state, along with the drifted resources
+func (t *TerraformExecutor) DetectDrift() (bool, []*ResourceChange, error) {
+	// Ensure terraform is initialized (needed for remote backends in CI)
+	if err := t.EnsureInit(); err != nil {
+		return false, nil, fmt.Errorf("failed to initialize terraform: %w", err)
+	}
+
+	planPath := filepath.Join(t.workDir, driftPlanFileName)
+	defer os.Remove(planPath)
+
+	drifted, err := t.PlanRefreshOnly(planPath)
+	if err != nil || !drifted {
+		return false, nil, err
+	}
+
+	summary, err := t.ShowPlan(planPath)
+	if err != nil {
+		return true, nil, err
+	}
+	return true, summary.Drift, nil
+}
+
+// ShowPlan summarizes a saved plan using terraform show -json
+func (t *TerraformExecutor) ShowPlan(planPath string) (*PlanSummary, error) {
+	cmd := &Command{Name: t.engine.Binary, Args: []string{"show", "-json", planPath}}
+	cmd.Dir = t.workDir
+	cmd.Env = os.Environ()
+
+	output, err := t.runner.Output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("%s show failed: %w", t.engine.Name, err)
+	}
+
+	return ParsePlanJSON(output)
+}
+
+// ApplyPlan runs terraform apply with a saved plan.
+// Terraform applies saved plans without prompting.
+func (t *TerraformExecutor) ApplyPlan(planPath string) error {
+	cmd := &Command{Name: t.engine.Binary, Args: append(withInputArgs([]string{"apply"}, false), planPath)}
+	cmd.Dir = t.workDir
+	cmd.Stdout = t.stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	if err := t.runner.Run(cmd); err != nil {
+		return fmt.Errorf("%s apply failed: %w", t.engine.Name, err)
 	}
 
 	return nil
 }
 
+// GetPlanPath resolves a plan file name against the workdir.
+// An empty name selects the default plan file.
+func (t *TerraformExecutor) GetPlanPath(name string) string {
+	if name == "" {
+		name = PlanFileName
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(t.workDir, name)
+}
+
+// GetConfigPath returns the path to config.tf.json in the workdir
+func (t *TerraformExecutor) GetConfigPath() string {
+	return filepath.Join(t.workDir, ConfigFileName)
+}
+
 // Destroy runs terraform destroy
 func (t *TerraformExecutor) Destroy() error {
-	cmd := exec.Command("terraform", "destroy")
+	cmd := &Command{Name: t.engine.Binary, Args: withInputArgs([]string{"destroy"}, true)}
 	cmd.Dir = t.workDir
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = t.stdout
 	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	cmd.Stdin = stdin()
 	cmd.Env = os.Environ()
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("terraform destroy failed: %w", err)
+	if err := t.runner.Run(cmd); err != nil {
+		return fmt.Errorf("%s destroy failed: %w", t.engine.Name, err)
 	}
 
 	return nil
@@ -144,38 +330,202 @@ type TerraformOutput struct {
 		Value string `json:"value"`
 	} `json:"public_ip"`
 
-	// Multiple named instances output: { "web-1": "1.2.3.4", "db-1": "5.6.7.8" }
+	// Multiple named instances output, each an IP or an object (see
+	// instanceOutput): { "web-1": "1.2.3.4", "db-1": { "public_ip": "5.6.7.8" } }
 	Instances struct {
-		Value map[string]string `json:"value"`
+		Value map[string]json.RawMessage `json:"value"`
 	} `json:"instances"`
+
+	// Optional instance tags, as lists or maps matched as key=value:
+	// { "web-1": ["web", "frontend"], "db-1": { "role": "db" } }
+	InstanceTags struct {
+		Value map[string]json.RawMessage `json:"value"`
+	} `json:"instance_tags"`
 }
 
 // GetTargetIP retrieves the public IP from terraform output
 func (t *TerraformExecutor) GetTargetIP() (string, error) {
+	terraformOutput, err := t.output()
+	if err != nil {
+		return "", err
+	}
+
+	if terraformOutput.PublicIP.Value == "" {
+		return "", fmt.Errorf("public_ip not found in terraform output")
+	}
+
+	return terraformOutput.PublicIP.Value, nil
+}
+
+// GetInstances retrieves all instances of the current project from terraform output
+func (t *TerraformExecutor) GetInstances() ([]*InstanceInfo, error) {
+	terraformOutput, err := t.output()
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := terraformOutput.instances(t.projectName)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no instances found in terraform output for project %q (expected 'instances' map or 'public_ip')", t.projectName)
+	}
+
+	return instances, nil
+}
+
+// output runs terraform output -json in the workdir and parses the result
+func (t *TerraformExecutor) output() (*TerraformOutput, error) {
 	// Ensure terraform is initialized (needed for remote backends in CI)
 	if err := t.EnsureInit(); err != nil {
-		return "", fmt.Errorf("failed to initialize terraform: %w", err)
+		return nil, fmt.Errorf("failed to initialize terraform: %w", err)
 	}
 
-	cmd := exec.Command("terraform", "output", "-json")
+	cmd := &Command{Name: t.engine.Binary, Args: []string{"output", "-json"}}
 	cmd.Dir = t.workDir
 	cmd.Env = os.Environ()
 
-	output, err := cmd.Output()
+	output, err := t.runner.Output(cmd)
 	if err != nil {
-		return "", fmt.Errorf("terraform output failed: %w", err)
+		return nil, fmt.Errorf("%s output failed: %w", t.engine.Name, err)
 	}
 
 	var terraformOutput TerraformOutput
 	if err := json.Unmarshal(output, &terraformOutput); err != nil {
-		return "", fmt.Errorf("failed to parse terraform output: %w", err)
+		return nil, fmt.Errorf("failed to parse terraform output: %w", err)
 	}
 
-	if terraformOutput.PublicIP.Value == "" {
-		return "", fmt.Errorf("public_ip not found in terraform output")
+	return &terraformOutput, nil
+}
+
+// instanceOutput is the object form of an entry in the instances output.
+// Only an address is required; empty fields fall back to the defaults.
+type instanceOutput struct {
+	PublicIP  string          `json:"public_ip"`
+	PrivateIP string          `json:"private_ip"`
+	SSHUser   string          `json:"ssh_user"`
+	SSHPort   json.Number     `json:"ssh_port"`
+	Tags      json.RawMessage `json:"tags"`
+	Region    string          `json:"region"`
+	HostKey   string          `json:"host_key"`
+	Bastion   string          `json:"bastion"`
+}
+
+// instances converts the parsed output into instance info, sorted by name.
+// The instances map takes precedence over the legacy public_ip output.
+func (o *TerraformOutput) instances(projectName string) ([]*InstanceInfo, error) {
+	var instances []*InstanceInfo
+
+	// Check for multiple instances first (instances map)
+	if len(o.Instances.Value) > 0 {
+		for name, raw := range o.Instances.Value {
+			inst, err := parseInstance(projectName, name, raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid instance %q in terraform output: %w", name, err)
+			}
+			inst.Tags = mergeTags(inst.Tags, parseTags(o.InstanceTags.Value[name]))
+			instances = append(instances, inst)
+		}
+		sort.Slice(instances, func(i, j int) bool {
+			return instances[i].InstanceName < instances[j].InstanceName
+		})
+		return instances, nil
 	}
 
-	return terraformOutput.PublicIP.Value, nil
+	// Fall back to legacy single instance (public_ip)
+	if o.PublicIP.Value != "" {
+		instances = append(instances, &InstanceInfo{
+			ProjectName:  projectName,
+			InstanceName: "", // Empty for single instance
+			PublicIP:     o.PublicIP.Value,
+		})
+	}
+
+	return instances, nil
+}
+
+// parseInstance converts an entry of the instances output, either an IP
+// string or an instanceOutput object
+func parseInstance(projectName, name string, raw json.RawMessage) (*InstanceInfo, error) {
+	inst := &InstanceInfo{ProjectName: projectName, InstanceName: name}
+
+	if err := json.Unmarshal(raw, &inst.PublicIP); err == nil {
+		return inst, nil
+	}
+
+	var out instanceOutput
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("expected an IP or an object: %w", err)
+	}
+	if out.PublicIP == "" && out.PrivateIP == "" {
+		return nil, fmt.Errorf("neither public_ip nor private_ip is set")
+	}
+
+	if out.SSHPort != "" {
+		port, err := strconv.Atoi(out.SSHPort.String())
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid ssh_port %s", out.SSHPort)
+		}
+		inst.SSHPort = port
+	}
+
+	inst.PublicIP = out.PublicIP
+	inst.PrivateIP = out.PrivateIP
+	inst.SSHUser = out.SSHUser
+	inst.Region = out.Region
+	inst.HostKey = strings.TrimSpace(out.HostKey)
+	inst.Bastion = out.Bastion
+	inst.Tags = parseTags(out.Tags)
+	return inst, nil
+}
+
+// mergeTags returns the sorted union of two tag lists
+func mergeTags(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	if len(a) == 0 {
+		return b
+	}
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, tag := range append(append([]string{}, a...), b...) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// parseTags converts an instance's tags, a list of strings or a map, into
+// a sorted list. Map entries become key=value; other values are ignored.
+func parseTags(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var tags []string
+	if err := json.Unmarshal(raw, &tags); err != nil {
+		var tagMap map[string]string
+		if err := json.Unmarshal(raw, &tagMap); err != nil {
+			return nil
+		}
+		for key, value := range tagMap {
+			tags = append(tags, key+"="+value)
+		}
+	}
+
+	sort.Strings(tags)
+	return tags
+}
+
+// GetEngine returns the engine used by the executor
+func (t *TerraformExecutor) GetEngine() *Engine {
+	return t.engine
 }
 
 // GetWorkDir returns the workdir path
@@ -188,6 +538,37 @@ type InstanceInfo struct {
 	ProjectName  string
 	InstanceName string // Empty for single-instance projects (legacy public_ip)
 	PublicIP     string
+	Tags         []string // From the instance object and the instance_tags output
+
+	// Optional fields of the object form of the instances output
+	PrivateIP string
+	SSHUser   string // Overrides SSH_USER and inframan.json, not --user
+	SSHPort   int    // 0 for the default port
+	Region    string
+	HostKey   string // Public host key, e.g. "ssh-ed25519 AAAA..."
+	Bastion   string // Jump host, overrides the project's (see ResolveJump)
+}
+
+// Address returns the address to connect to: the public IP, or the private
+// IP for instances without one
+func (i *InstanceInfo) Address() string {
+	return firstNonEmpty(i.PublicIP, i.PrivateIP)
+}
+
+// Port returns the instance's SSH port
+func (i *InstanceInfo) Port() int {
+	if i.SSHPort == 0 {
+		return DefaultSSHPort
+	}
+	return i.SSHPort
+}
+
+// NodeName returns the name of the instance's node in the generated Colmena hive
+func (i *InstanceInfo) NodeName() string {
+	if i.InstanceName == "" {
+		return DefaultNodeName
+	}
+	return i.InstanceName
 }
 
 // FullName returns the full identifier for the instance (project/instance or just project)
@@ -210,18 +591,23 @@ func GetInstancesForProject(projectName string) ([]*InstanceInfo, error) {
 		return nil, fmt.Errorf("project %q does not exist", projectName)
 	}
 
+	engine, err := ResolveEngine(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve engine for project %q: %w", projectName, err)
+	}
+
 	// Ensure terraform is initialized (needed for remote backends in CI)
-	if err := ensureInitInDir(terraformDir); err != nil {
+	if err := ensureInitInDir(terraformDir, engine); err != nil {
 		return nil, fmt.Errorf("failed to initialize terraform for project %q: %w", projectName, err)
 	}
 
-	cmd := exec.Command("terraform", "output", "-json")
+	cmd := &Command{Name: engine.Binary, Args: []string{"output", "-json"}}
 	cmd.Dir = terraformDir
 	cmd.Env = os.Environ()
 
-	output, err := cmd.Output()
+	output, err := DefaultRunner.Output(cmd)
 	if err != nil {
-		return nil, fmt.Errorf("terraform output failed for project %q: %w", projectName, err)
+		return nil, fmt.Errorf("%s output failed for project %q: %w", engine.Name, projectName, err)
 	}
 
 	var terraformOutput TerraformOutput
@@ -229,27 +615,11 @@ func GetInstancesForProject(projectName string) ([]*InstanceInfo, error) {
 		return nil, fmt.Errorf("failed to parse terraform output: %w", err)
 	}
 
-	var instances []*InstanceInfo
-
-	// Check for multiple instances first (instances map)
-	if len(terraformOutput.Instances.Value) > 0 {
-		for name, ip := range terraformOutput.Instances.Value {
-			instances = append(instances, &InstanceInfo{
-				ProjectName:  projectName,
-				InstanceName: name,
-				PublicIP:     ip,
-			})
-		}
-		return instances, nil
+	instances, err := terraformOutput.instances(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("project %q: %w", projectName, err)
 	}
-
-	// Fall back to legacy single instance (public_ip)
-	if terraformOutput.PublicIP.Value != "" {
-		instances = append(instances, &InstanceInfo{
-			ProjectName:  projectName,
-			InstanceName: "", // Empty for single instance
-			PublicIP:     terraformOutput.PublicIP.Value,
-		})
+	if len(instances) > 0 {
 		return instances, nil
 	}
 
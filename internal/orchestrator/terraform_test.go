@@ -0,0 +1,318 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestGetInstancesForProject(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []string // FullName=PublicIP
+		wantErr string
+	}{
+		{
+			name:   "instances map sorted by name",
+			output: `{"instances": {"value": {"web-2": "10.0.0.2", "db-1": "10.0.0.3", "web-1": "10.0.0.1"}}}`,
+			want:   []string{"prod/db-1=10.0.0.3", "prod/web-1=10.0.0.1", "prod/web-2=10.0.0.2"},
+		},
+		{
+			name:   "instances map takes precedence over public_ip",
+			output: `{"public_ip": {"value": "1.2.3.4"}, "instances": {"value": {"web-1": "10.0.0.1"}}}`,
+			want:   []string{"prod/web-1=10.0.0.1"},
+		},
+		{
+			name:   "legacy public_ip",
+			output: `{"public_ip": {"value": "1.2.3.4"}}`,
+			want:   []string{"prod=1.2.3.4"},
+		},
+		{
+			name:   "object form mixed with IPs",
+			output: `{"instances": {"value": {"web-1": "10.0.0.1", "db-1": {"public_ip": null, "private_ip": "10.1.0.5"}}}}`,
+			want:   []string{"prod/db-1=", "prod/web-1=10.0.0.1"},
+		},
+		{
+			name:    "object without address",
+			output:  `{"instances": {"value": {"db-1": {"region": "eu-west-1"}}}}`,
+			wantErr: "neither public_ip nor private_ip",
+		},
+		{
+			name:    "invalid ssh_port",
+			output:  `{"instances": {"value": {"db-1": {"public_ip": "10.0.0.1", "ssh_port": 70000}}}}`,
+			wantErr: "invalid ssh_port",
+		},
+		{
+			name:    "no instances",
+			output:  `{"instance_id": {"value": "i-123"}}`,
+			wantErr: "no instances found",
+		},
+		{
+			name:    "invalid json",
+			output:  `not json`,
+			wantErr: "failed to parse terraform output",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupWorkspace(t)
+			createProject(t, "prod")
+			fake.On("terraform output -json", orchestratortest.FakeResponse{Stdout: tt.output})
+
+			instances, err := GetInstancesForProject("prod")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, inst := range instances {
+				got = append(got, inst.FullName()+"="+inst.PublicIP)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("instances = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetInstancesForProjectObjectForm(t *testing.T) {
+	fake := setupWorkspace(t)
+	createProject(t, "prod")
+	fake.On("terraform output -json", orchestratortest.FakeResponse{Stdout: `{
+		"instances": {"value": {"db-1": {
+			"public_ip": "1.2.3.4",
+			"private_ip": "10.1.0.5",
+			"ssh_user": "ubuntu",
+			"ssh_port": "2222",
+			"tags": {"role": "db"},
+			"region": "eu-west-1",
+			"host_key": "ssh-ed25519 AAAAC3Nza\n"
+		}}},
+		"instance_tags": {"value": {"db-1": ["primary", "role=db"]}}
+	}`})
+
+	instances, err := GetInstancesForProject("prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inst := instances[0]
+
+	if inst.PublicIP != "1.2.3.4" || inst.PrivateIP != "10.1.0.5" || inst.Address() != "1.2.3.4" {
+		t.Errorf("addresses = %q, %q", inst.PublicIP, inst.PrivateIP)
+	}
+	if inst.SSHUser != "ubuntu" || inst.SSHPort != 2222 || inst.Port() != 2222 {
+		t.Errorf("ssh user and port = %q, %d", inst.SSHUser, inst.SSHPort)
+	}
+	if inst.Region != "eu-west-1" || inst.HostKey != "ssh-ed25519 AAAAC3Nza" {
+		t.Errorf("region and host key = %q, %q", inst.Region, inst.HostKey)
+	}
+	if got := strings.Join(inst.Tags, ","); got != "primary,role=db" {
+		t.Errorf("tags = %q, want merged tags", got)
+	}
+}
+
+func TestGetInstancesForProjectRunsInProjectDir(t *testing.T) {
+	fake := setupWorkspace(t)
+	terraformDir := createProject(t, "prod")
+	fake.On("terraform output -json", orchestratortest.FakeResponse{Stdout: `{"public_ip": {"value": "1.2.3.4"}}`})
+
+	if _, err := GetInstancesForProject("prod"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("calls = %v, want only terraform output (already initialized)", fake.CommandLines())
+	}
+	if calls[0].Dir != terraformDir {
+		t.Errorf("dir = %q, want %q", calls[0].Dir, terraformDir)
+	}
+}
+
+func TestGetInstancesForProjectInitializes(t *testing.T) {
+	fake := setupWorkspace(t)
+	if err := EnsureDir(mustTerraformDir(t, "prod")); err != nil {
+		t.Fatal(err)
+	}
+	fake.On("terraform output -json", orchestratortest.FakeResponse{Stdout: `{"public_ip": {"value": "1.2.3.4"}}`})
+
+	if _, err := GetInstancesForProject("prod"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := strings.Join(fake.CommandLines(), "; ")
+	if got != "terraform init; terraform output -json" {
+		t.Errorf("commands = %q", got)
+	}
+}
+
+func TestGetInstancesForProjectMissing(t *testing.T) {
+	setupWorkspace(t)
+
+	_, err := GetInstancesForProject("missing")
+	if err == nil || !strings.Contains(err.Error(), `project "missing" does not exist`) {
+		t.Fatalf("error = %v, want project does not exist", err)
+	}
+}
+
+func TestGetInstancesForProjectOutputFails(t *testing.T) {
+	fake := setupWorkspace(t)
+	createProject(t, "prod")
+	fake.On("terraform output", orchestratortest.FakeResponse{ExitCode: 1})
+
+	_, err := GetInstancesForProject("prod")
+	if err == nil || !strings.Contains(err.Error(), "terraform output failed") {
+		t.Fatalf("error = %v, want terraform output failed", err)
+	}
+}
+
+func TestGetInstance(t *testing.T) {
+	multi := `{"instances": {"value": {"web-1": "10.0.0.1", "db-1": "10.0.0.2"}}}`
+	single := `{"public_ip": {"value": "1.2.3.4"}}`
+
+	tests := []struct {
+		name     string
+		output   string
+		instance string
+		wantIP   string
+		wantErr  string
+	}{
+		{name: "named instance", output: multi, instance: "db-1", wantIP: "10.0.0.2"},
+		{name: "single instance without name", output: single, wantIP: "1.2.3.4"},
+		{name: "multiple instances without name", output: multi, wantErr: "has 2 instances, specify one: [db-1, web-1]"},
+		{name: "unknown instance", output: multi, instance: "web-9", wantErr: `instance "web-9" not found in project "prod", available: [db-1, web-1]`},
+		{name: "named instance in single-instance project", output: single, instance: "web-1", wantErr: "available: [(default)]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupWorkspace(t)
+			createProject(t, "prod")
+			fake.On("terraform output -json", orchestratortest.FakeResponse{Stdout: tt.output})
+
+			inst, err := GetInstance("prod", tt.instance)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if inst.PublicIP != tt.wantIP {
+				t.Errorf("PublicIP = %q, want %q", inst.PublicIP, tt.wantIP)
+			}
+		})
+	}
+}
+
+func TestTerraformExecutorApplyChanges(t *testing.T) {
+	tests := []struct {
+		name        string
+		planExit    int
+		wantChanged bool
+		wantCmds    []string
+		wantErr     bool
+	}{
+		{name: "no changes", planExit: 0, wantCmds: []string{"plan"}},
+		{name: "changes", planExit: 2, wantChanged: true, wantCmds: []string{"plan", "apply"}},
+		{name: "plan fails", planExit: 1, wantCmds: []string{"plan"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupWorkspace(t)
+			SetNonInteractive(true)
+			t.Cleanup(func() { SetNonInteractive(false) })
+
+			terraformExec, err := NewTerraformExecutor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake := orchestratortest.NewFakeRunner()
+			fake.On("terraform plan", orchestratortest.FakeResponse{ExitCode: tt.planExit})
+			terraformExec.SetRunner(fake)
+
+			changed, err := terraformExec.ApplyChanges(false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+
+			calls := fake.Calls()
+			if len(calls) != len(tt.wantCmds) {
+				t.Fatalf("commands = %v, want %v", fake.CommandLines(), tt.wantCmds)
+			}
+			for i, call := range calls {
+				if call.Args[0] != tt.wantCmds[i] {
+					t.Errorf("command %d = %q, want %s", i, call.String(), tt.wantCmds[i])
+				}
+				if !strings.Contains(call.String(), "-input=false") {
+					t.Errorf("command %q missing -input=false", call.String())
+				}
+			}
+		})
+	}
+}
+
+func mustTerraformDir(t *testing.T, project string) string {
+	t.Helper()
+	dir, err := GetTerraformDirForProject(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestTerraformExecutorDetectDrift(t *testing.T) {
+	tests := []struct {
+		name        string
+		planExit    int
+		wantDrifted bool
+		wantDrift   int
+		wantErr     bool
+	}{
+		{name: "in sync", planExit: 0},
+		{name: "drifted", planExit: 2, wantDrifted: true, wantDrift: 1},
+		{name: "plan fails", planExit: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupWorkspace(t)
+			createProject(t, "prod")
+
+			terraformExec, err := NewTerraformExecutorForProject("prod")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake := orchestratortest.NewFakeRunner()
+			fake.On("terraform plan -refresh-only", orchestratortest.FakeResponse{ExitCode: tt.planExit})
+			fake.On("terraform show -json", orchestratortest.FakeResponse{Stdout: `{"resource_drift": [{"address": "aws_instance.web", "change": {"actions": ["update"]}}]}`})
+			terraformExec.SetRunner(fake)
+
+			drifted, drift, err := terraformExec.DetectDrift()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if drifted != tt.wantDrifted || len(drift) != tt.wantDrift {
+				t.Errorf("DetectDrift() = %v, %d resources; want %v, %d", drifted, len(drift), tt.wantDrifted, tt.wantDrift)
+			}
+			if calls := fake.Calls(); calls[0].Dir != terraformExec.GetWorkDir() {
+				t.Errorf("dir = %q, want %q", calls[0].Dir, terraformExec.GetWorkDir())
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 // TerranixExecutor handles Terranix command execution for generating Terraform JSON from Nix
 type TerranixExecutor struct {
 	workDir string
+	runner  Runner
 }
 
 // NewTerranixExecutor creates a new Terranix executor
@@ -24,7 +25,12 @@ func NewTerranixExecutor() (*TerranixExecutor, error) {
 		return nil, err
 	}
 
-	return &TerranixExecutor{workDir: workDir}, nil
+	return &TerranixExecutor{workDir: workDir, runner: DefaultRunner}, nil
+}
+
+// SetRunner replaces the runner used to execute terranix
+func (t *TerranixExecutor) SetRunner(runner Runner) {
+	t.runner = runner
 }
 
 // Build runs terranix to generate config.tf.json from a Nix file
@@ -43,10 +49,10 @@ func (t *TerranixExecutor) Build(nixFilePath string) (string, error) {
 	}
 
 	// Run terranix to generate JSON
-	cmd := exec.Command("terranix", absNixPath)
+	cmd := &Command{Name: "terranix", Args: []string{absNixPath}}
 	cmd.Env = os.Environ()
 
-	output, err := cmd.Output()
+	output, err := t.runner.Output(cmd)
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			return "", fmt.Errorf("terranix build failed: %w\n%s", err, string(exitErr.Stderr))
@@ -0,0 +1,171 @@
+package orchestrator
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tunnelStableAfter is how long a tunnel must stay up before a drop is
+// reconnected rather than reported as a failure to connect
+const tunnelStableAfter = 10 * time.Second
+
+// Forward is a local port forwarded to an address reached from an instance
+type Forward struct {
+	Bind       string // Local address to listen on (default: localhost)
+	LocalPort  int
+	Host       string // As resolved on the instance, e.g. localhost
+	RemotePort int
+}
+
+// ParseForward parses a port forward:
+//
+//	5432                               localhost:5432 on the instance, same local port
+//	15432:5432                         localhost:5432 on the instance, local port 15432
+//	15432:db.internal:5432             db.internal:5432 as reached from the instance
+//	127.0.0.1:15432:db.internal:5432   with the local bind address
+func ParseForward(spec string) (*Forward, error) {
+	parts := strings.Split(spec, ":")
+	var f Forward
+	var localPort, remotePort string
+	switch len(parts) {
+	case 1:
+		localPort, f.Host, remotePort = parts[0], "localhost", parts[0]
+	case 2:
+		localPort, f.Host, remotePort = parts[0], "localhost", parts[1]
+	case 3:
+		localPort, f.Host, remotePort = parts[0], parts[1], parts[2]
+	case 4:
+		f.Bind, localPort, f.Host, remotePort = parts[0], parts[1], parts[2], parts[3]
+	default:
+		return nil, fmt.Errorf("invalid forward %q, expected [bind:]local:[host:]remote", spec)
+	}
+
+	var err error
+	if f.LocalPort, err = parsePort(localPort); err != nil {
+		return nil, fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+	if f.RemotePort, err = parsePort(remotePort); err != nil {
+		return nil, fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+	if f.Host == "" {
+		return nil, fmt.Errorf("invalid forward %q: missing host", spec)
+	}
+	return &f, nil
+}
+
+// parsePort parses a TCP port number
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// String returns the forward as an ssh -L argument
+func (f *Forward) String() string {
+	spec := fmt.Sprintf("%d:%s:%d", f.LocalPort, f.Host, f.RemotePort)
+	if f.Bind != "" {
+		spec = f.Bind + ":" + spec
+	}
+	return spec
+}
+
+// Local returns the local address the forward listens on
+func (f *Forward) Local() string {
+	return net.JoinHostPort(firstNonEmpty(f.Bind, "localhost"), strconv.Itoa(f.LocalPort))
+}
+
+// Remote returns the address connections are forwarded to from the instance
+func (f *Forward) Remote() string {
+	return net.JoinHostPort(f.Host, strconv.Itoa(f.RemotePort))
+}
+
+// TunnelOptions configures the tunnels opened by Tunnel
+type TunnelOptions struct {
+	SSH      SSHOptions
+	Forwards []*Forward
+
+	// SOCKSPort opens a SOCKS proxy on this local port (0 for none)
+	SOCKSPort int
+
+	// Reconnect restarts the tunnels when the connection drops
+	Reconnect bool
+}
+
+// tunnelArgs returns the ssh arguments keeping the tunnels of opts open
+// without running a command. ssh exits if a port cannot be forwarded or the
+// instance stops answering keepalives, so drops are noticed.
+func tunnelArgs(inst *InstanceInfo, opts TunnelOptions) ([]string, error) {
+	if len(opts.Forwards) == 0 && opts.SOCKSPort == 0 {
+		return nil, fmt.Errorf("no tunnels requested")
+	}
+
+	sshArgs, err := SSHArgs(inst, opts.SSH)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-N",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=15",
+		"-o", "ServerAliveCountMax=3",
+	}
+	for _, f := range opts.Forwards {
+		args = append(args, "-L", f.String())
+	}
+	if opts.SOCKSPort != 0 {
+		args = append(args, "-D", strconv.Itoa(opts.SOCKSPort))
+	}
+	return append(args, sshArgs...), nil
+}
+
+// Tunnel keeps the tunnels of opts open to an instance until ssh exits. With
+// Reconnect, a tunnel that drops after it was established is reopened with
+// backoff; failing to establish the first connection is always an error.
+func Tunnel(inst *InstanceInfo, opts TunnelOptions) error {
+	args, err := tunnelArgs(inst, opts)
+	if err != nil {
+		return err
+	}
+
+	backoff := initialBackoff
+	for connected := false; ; {
+		started := time.Now()
+		err := DefaultRunner.Run(&Command{
+			Name:   "ssh",
+			Args:   args,
+			Env:    os.Environ(),
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
+
+		stable := time.Since(started) >= tunnelStableAfter
+		if stable {
+			connected = true
+			backoff = initialBackoff
+		}
+		if !opts.Reconnect || !connected {
+			if err != nil {
+				return fmt.Errorf("tunnel to %s failed: %w", inst.FullName(), err)
+			}
+			return nil
+		}
+
+		reason := "connection closed"
+		if err != nil {
+			reason = err.Error()
+		}
+		fmt.Fprintf(os.Stderr, "Tunnel to %s dropped (%s), reconnecting in %s...\n", inst.FullName(), reason, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iivel-inc/inframan/internal/orchestrator/orchestratortest"
+)
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		remote  string
+		wantErr bool
+	}{
+		{spec: "5432", want: "5432:localhost:5432", remote: "localhost:5432"},
+		{spec: "15432:5432", want: "15432:localhost:5432", remote: "localhost:5432"},
+		{spec: "9000:admin.internal:9000", want: "9000:admin.internal:9000", remote: "admin.internal:9000"},
+		{spec: "0.0.0.0:8080:localhost:80", want: "0.0.0.0:8080:localhost:80", remote: "localhost:80"},
+		{spec: "", wantErr: true},
+		{spec: "http", wantErr: true},
+		{spec: "8080:70000", wantErr: true},
+		{spec: "8080::80", wantErr: true},
+		{spec: "a:b:c:d:e", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		f, err := ParseForward(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseForward(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if f.String() != tt.want || f.Remote() != tt.remote {
+			t.Errorf("ParseForward(%q) = %q to %q, want %q to %q", tt.spec, f, f.Remote(), tt.want, tt.remote)
+		}
+	}
+}
+
+func TestTunnel(t *testing.T) {
+	fake := setupWorkspace(t)
+	inst := &InstanceInfo{ProjectName: "prod", InstanceName: "db-1", PublicIP: "10.0.0.2"}
+	forward, err := ParseForward("15432:5432")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := TunnelOptions{Forwards: []*Forward{forward}, SOCKSPort: 1080, Reconnect: true}
+
+	if err := Tunnel(inst, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fake.CommandLines()[0]
+	if !strings.HasPrefix(got, "ssh -N -o ExitOnForwardFailure=yes -o ServerAliveInterval=15 -o ServerAliveCountMax=3 -L 15432:localhost:5432 -D 1080 ") ||
+		!strings.HasSuffix(got, " root@10.0.0.2") {
+		t.Errorf("command = %q", got)
+	}
+
+	// A tunnel that never came up is not reconnected
+	fake.On("ssh", orchestratortest.FakeResponse{ExitCode: 255})
+	if err := Tunnel(inst, opts); err == nil || !strings.Contains(err.Error(), "tunnel to prod/db-1 failed") {
+		t.Errorf("Tunnel() error = %v", err)
+	}
+	if calls := len(fake.CommandLines()); calls != 2 {
+		t.Errorf("ssh ran %d times, want 2", calls)
+	}
+
+	if _, err := tunnelArgs(inst, TunnelOptions{}); err == nil {
+		t.Error("tunnelArgs() without tunnels succeeded")
+	}
+}
@@ -0,0 +1,119 @@
+// Package runner runs external commands behind an interface so that callers
+// can be tested without the real binaries.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrTimeout is returned when a command is killed after exceeding its Timeout
+var ErrTimeout = errors.New("timed out")
+
+// Command describes an external process to run
+type Command struct {
+	Name   string
+	Args   []string
+	Dir    string
+	Env    []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Timeout kills the process if it runs longer (0 for no limit)
+	Timeout time.Duration
+}
+
+// String returns the command line, e.g. "terraform output -json"
+func (c *Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Runner executes external commands. Executors use it instead of os/exec
+// directly so they can be tested without the real binaries.
+type Runner interface {
+	// Run runs the command to completion, wiring its configured streams
+	Run(cmd *Command) error
+
+	// Output runs the command and returns its standard output
+	Output(cmd *Command) ([]byte, error)
+
+	// Exec replaces the current process with the command
+	Exec(cmd *Command) error
+}
+
+// ExecRunner runs commands with os/exec
+type ExecRunner struct{}
+
+// command converts a Command into an exec.Cmd. The returned context expires
+// after the command's timeout; cancel must be called once it has finished.
+func (ExecRunner) command(c *Command) (cmd *exec.Cmd, ctx context.Context, cancel context.CancelFunc) {
+	ctx, cancel = context.Background(), func() {}
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), c.Timeout)
+	}
+
+	cmd = exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Env = c.Env
+	// Only set non-nil streams so exec falls back to the null device
+	// (and captures stderr in exec.ExitError for Output)
+	if c.Stdin != nil {
+		cmd.Stdin = c.Stdin
+	}
+	if c.Stdout != nil {
+		cmd.Stdout = c.Stdout
+	}
+	if c.Stderr != nil {
+		cmd.Stderr = c.Stderr
+	}
+	return cmd, ctx, cancel
+}
+
+// Run runs the command with os/exec
+func (r ExecRunner) Run(c *Command) error {
+	cmd, ctx, cancel := r.command(c)
+	defer cancel()
+	return timeoutError(ctx, c, cmd.Run())
+}
+
+// Output runs the command with os/exec and returns its standard output
+func (r ExecRunner) Output(c *Command) ([]byte, error) {
+	cmd, ctx, cancel := r.command(c)
+	defer cancel()
+	cmd.Stdout = nil
+	output, err := cmd.Output()
+	return output, timeoutError(ctx, c, err)
+}
+
+// timeoutError replaces the error of a command killed by its timeout with ErrTimeout
+func timeoutError(ctx context.Context, c *Command, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s %w after %s", c.Name, ErrTimeout, c.Timeout)
+	}
+	return err
+}
+
+// Exec replaces the current process with the command using execve
+func (ExecRunner) Exec(c *Command) error {
+	path, err := exec.LookPath(c.Name)
+	if err != nil {
+		return fmt.Errorf("%s not found in PATH: %w", c.Name, err)
+	}
+	return syscall.Exec(path, append([]string{c.Name}, c.Args...), c.Env)
+}
+
+// ExitCode returns the exit code carried by err, if any
+func ExitCode(err error) (int, bool) {
+	var coder interface{ ExitCode() int }
+	if errors.As(err, &coder) {
+		return coder.ExitCode(), true
+	}
+	return 0, false
+}